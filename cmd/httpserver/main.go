@@ -7,13 +7,20 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/harry713j/http-server/internal/compress"
+	"github.com/harry713j/http-server/internal/fileserver"
+	"github.com/harry713j/http-server/internal/forwarded"
 	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/proxyproto"
 	"github.com/harry713j/http-server/internal/request"
 	"github.com/harry713j/http-server/internal/response"
 	"github.com/harry713j/http-server/internal/server"
@@ -21,7 +28,47 @@ import (
 
 const port = 42069
 
+// listenAddrs reads LISTEN_ADDRS, a comma separated list of addresses
+// like tcp://127.0.0.1:8080 or unix:///run/app.sock, see server.Listen.
+func listenAddrs() []string {
+	addrs := strings.Split(os.Getenv("LISTEN_ADDRS"), ",")
+	if len(addrs) == 1 && addrs[0] == "" {
+		return []string{fmt.Sprintf("tcp://:%d", port)}
+	}
+	return addrs
+}
+
+// trustedPrefixes reads a comma separated list of CIDRs from env, nil if
+// it is not set.
+func trustedPrefixes(env string) []netip.Prefix {
+	v := os.Getenv(env)
+	if v == "" {
+		return nil
+	}
+
+	var prefixes []netip.Prefix
+	for _, cidr := range strings.Split(v, ",") {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			log.Fatalf("Invalid %s: %v", env, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
 func main() {
+	// without the assets directory /video and /assets/ answer 404, the
+	// rest of the routes work as usual
+	var assetServer *fileserver.FileServer
+	assets, err := fileserver.Dir("./assets")
+	if err != nil {
+		log.Printf("Error opening assets, serving without them: %v", err)
+	} else {
+		assetServer = fileserver.New(assets, fileserver.Options{StripPrefix: "/assets", ListDirectories: true})
+	}
+	noAssets := &server.HandlerError{StatusCode: response.StatusNotFound, Message: "assets are not available"}
+
 	handler := func(w io.Writer, r *request.Request) *server.HandlerError {
 		respWriter := response.NewWriter(w)
 
@@ -31,7 +78,21 @@ func main() {
 		}
 
 		if strings.HasPrefix(r.RequestLine.RequestTarget, "/video") {
-			return video(respWriter)
+			if assetServer == nil {
+				return noAssets
+			}
+			return fileserver.ServeFile(respWriter, r, assets, "vim.mp4")
+		}
+
+		if strings.HasPrefix(r.RequestLine.RequestTarget, "/assets/") {
+			if assetServer == nil {
+				return noAssets
+			}
+			return assetServer.Handle(respWriter, r)
+		}
+
+		if r.RequestLine.RequestTarget == "/echo" {
+			return echo(r, respWriter)
 		}
 
 		var (
@@ -99,16 +160,74 @@ func main() {
 		return nil
 	}
 
-	server, err := server.Serve(port, handler)
+	compressor := compress.New(compress.Options{})
+	decompressor := compress.NewDecompressor(compress.DecompressOptions{})
+
+	opts := []server.Option{
+		server.WithConnLimits(server.ConnLimits{MaxConns: 10000, MaxConnsPerIP: 256}),
+		server.WithShedIdleConns(100),
+		server.WithTimeouts(server.Timeouts{Idle: time.Minute, Read: 30 * time.Second}),
+	}
+
+	// TLS_CERT and TLS_KEY switch the server to TLS
+	if certFile, keyFile := os.Getenv("TLS_CERT"), os.Getenv("TLS_KEY"); certFile != "" && keyFile != "" {
+		opts = append(opts, server.WithTLS(server.TLSConfig{
+			Certificates:   []server.CertFile{{CertFile: certFile, KeyFile: keyFile}},
+			ReloadInterval: time.Minute,
+		}))
+	}
+
+	// PROXY_TRUSTED reads PROXY protocol headers from those load balancers
+	if trusted := trustedPrefixes("PROXY_TRUSTED"); trusted != nil {
+		opts = append(opts, server.WithProxyProtocol(proxyproto.Options{Trusted: trusted}))
+	}
+
+	root := decompressor.Middleware(compressor.Middleware(handler))
+
+	// FORWARDED_TRUSTED believes the Forwarded headers of those proxies
+	if trusted := trustedPrefixes("FORWARDED_TRUSTED"); trusted != nil {
+		root = forwarded.New(forwarded.Options{Trusted: trusted}).Middleware(root)
+	}
+
+	srv, err := server.ServeAddrs(listenAddrs(), root, opts...)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
-	log.Println("Server started on port", port)
+	log.Println("Server started on", srv.Addrs())
+
+	// let the process that started us with an upgrade know we're serving
+	if err := server.NotifyReady(); err != nil {
+		log.Printf("Error notifying parent process: %v", err)
+	}
 
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, append(upgradeSignals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)...)
+	for sig := range sigChan {
+		if slices.Contains(upgradeSignals, sig) {
+			proc, err := srv.Upgrade(10 * time.Second)
+			if err != nil {
+				log.Printf("Error upgrading: %v", err)
+				continue
+			}
+			log.Println("Handed over to process", proc.Pid)
+			break
+		}
+
+		if sig != syscall.SIGHUP {
+			break
+		}
+
+		if err := srv.ReloadTLS(); err != nil {
+			log.Printf("Error reloading certificates: %v", err)
+			continue
+		}
+		log.Println("Reloaded TLS certificates")
+	}
+
+	// finish the requests in flight, an upgraded process takes the new ones
+	if err := srv.Shutdown(30 * time.Second); err != nil {
+		log.Printf("Error closing listeners: %v", err)
+	}
 	log.Println("Server gracefully stopped")
 }
 
@@ -116,7 +235,13 @@ func proxy(r *request.Request, respWriter *response.Writer) *server.HandlerError
 	proxyPath := strings.TrimPrefix(r.RequestLine.RequestTarget, "/httpbin")
 	proxyUrl := "https://httpbin.org" + proxyPath
 
-	resp, err := http.Get(proxyUrl)
+	// the upstream request is abandoned when the client goes away
+	upstreamReq, err := http.NewRequestWithContext(r.Context(), http.MethodGet, proxyUrl, nil)
+	if err != nil {
+		return &server.HandlerError{StatusCode: response.StatusInternalServerError, Message: err.Error()}
+	}
+
+	resp, err := http.DefaultClient.Do(upstreamReq)
 
 	if err != nil {
 		return &server.HandlerError{StatusCode: response.StatusInternalServerError, Message: err.Error()}
@@ -159,6 +284,11 @@ func proxy(r *request.Request, respWriter *response.Writer) *server.HandlerError
 			if _, err := respWriter.WriteChunkedBody(buff[:n]); err != nil {
 				return &server.HandlerError{StatusCode: response.StatusInternalServerError, Message: err.Error()}
 			}
+
+			// pass each chunk on as soon as upstream delivers it
+			if err := respWriter.Flush(); err != nil {
+				return &server.HandlerError{StatusCode: response.StatusInternalServerError, Message: err.Error()}
+			}
 		}
 
 	}
@@ -184,26 +314,16 @@ func proxy(r *request.Request, respWriter *response.Writer) *server.HandlerError
 	return nil
 }
 
-func video(respWriter *response.Writer) *server.HandlerError {
-	data, err := os.ReadFile("./assets/vim.mp4")
-
-	if err != nil {
-		return &server.HandlerError{StatusCode: response.StatusInternalServerError, Message: err.Error()}
-	}
-
-	headers := header.NewHeaders()
-	headers.Add("Connection", "close")
-	headers.Add("Content-Type", "video/mp4")
-
-	if err := respWriter.WriteStatusLine(response.StatusOk); err != nil {
-		return &server.HandlerError{StatusCode: response.StatusInternalServerError, Message: err.Error()}
+func echo(r *request.Request, respWriter *response.Writer) *server.HandlerError {
+	var body struct {
+		Message string `json:"message"`
 	}
 
-	if err := respWriter.WriteHeaders(headers); err != nil {
-		return &server.HandlerError{StatusCode: response.StatusInternalServerError, Message: err.Error()}
+	if hErr := server.DecodeJSON(r, &body, 0); hErr != nil {
+		return hErr
 	}
 
-	if _, err := respWriter.WriteBody(data); err != nil {
+	if err := respWriter.WriteJSON(response.StatusOk, body); err != nil {
 		return &server.HandlerError{StatusCode: response.StatusInternalServerError, Message: err.Error()}
 	}
 
@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignals start a new binary that takes over the listeners.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
@@ -0,0 +1,185 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/harry713j/http-server/internal/server"
+)
+
+const DefaultMinSize = 1024
+
+// DefaultContentTypes are compressed when Options.ContentTypes is empty.
+// Entries ending in "/" match a whole top level type.
+var DefaultContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+type Options struct {
+	// Level is a compress/flate level, gzip.DefaultCompression when 0
+	Level int
+	// MinSize skips fixed-length bodies smaller than this many bytes,
+	// DefaultMinSize when 0. Chunked bodies have no known size and are
+	// always compressed.
+	MinSize int
+	// ContentTypes lists the compressible media types. +json and +xml
+	// suffixed types are always compressible.
+	ContentTypes []string
+}
+
+type Compressor struct {
+	opts     Options
+	gzipPool sync.Pool
+	zlibPool sync.Pool
+}
+
+func New(opts Options) *Compressor {
+	if opts.Level == 0 || opts.Level < gzip.HuffmanOnly || opts.Level > gzip.BestCompression {
+		opts.Level = gzip.DefaultCompression
+	}
+
+	if opts.MinSize == 0 {
+		opts.MinSize = DefaultMinSize
+	}
+
+	if len(opts.ContentTypes) == 0 {
+		opts.ContentTypes = DefaultContentTypes
+	}
+
+	return &Compressor{opts: opts}
+}
+
+// Middleware compresses eligible responses of next with gzip or deflate,
+// whichever the request's Accept-Encoding prefers.
+func (c *Compressor) Middleware(next server.Handler) server.Handler {
+	return func(w io.Writer, r *request.Request) *server.HandlerError {
+		respWriter := response.NewWriter(w)
+
+		// the encoded body is chunked, which HTTP/1.0 clients can't read
+		if r.RequestLine.Method == "HEAD" || r.RequestLine.HttpVersion == "1.0" {
+			return next(respWriter, r)
+		}
+
+		respWriter.BeforeWriteHeaders(func(h header.Headers) {
+			if !c.compressible(respWriter.Status(), h) {
+				return
+			}
+
+			encoding := response.Negotiate(respWriter, r.Headers, "Accept-Encoding", "gzip", "deflate", "identity")
+			if encoding != "gzip" && encoding != "deflate" {
+				return
+			}
+
+			h.Remove("Content-Length")
+			h.Add("Content-Encoding", encoding)
+
+			// the encoded bytes differ from the ones the handler's strong
+			// ETag and byte ranges refer to. A weak ETag still lets
+			// If-None-Match revalidate.
+			if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				h.Remove("ETag")
+				h.Add("ETag", "W/"+etag)
+			}
+			h.Remove("Accept-Ranges")
+			if !strings.Contains(strings.ToLower(h.Get("Transfer-Encoding")), "chunked") {
+				h.Remove("Transfer-Encoding")
+				h.Add("Transfer-Encoding", "chunked")
+			}
+
+			respWriter.SetBodyEncoder(c.encoder(encoding))
+		})
+
+		return next(respWriter, r)
+	}
+}
+
+func (c *Compressor) compressible(status response.StatusCode, h header.Headers) bool {
+	// compressing a 206 would make Content-Range refer to the wrong bytes
+	if status < 200 || status == 204 || status == 206 || status == 304 {
+		return false
+	}
+
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	if strings.Contains(strings.ToLower(h.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+
+	if length := h.Get("Content-Length"); length != "" {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < c.opts.MinSize {
+			return false
+		}
+	}
+
+	mediaType, _, _ := strings.Cut(h.Get("Content-Type"), ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+	if strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+
+	for _, t := range c.opts.ContentTypes {
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+
+	// everything else, including already compressed media such as
+	// video/mp4, images and archives, is sent as is
+	return false
+}
+
+func (c *Compressor) encoder(encoding string) response.BodyEncoder {
+	return func(dst io.Writer) io.WriteCloser {
+		if encoding == "gzip" {
+			gz, ok := c.gzipPool.Get().(*gzip.Writer)
+			if ok {
+				gz.Reset(dst)
+			} else {
+				gz, _ = gzip.NewWriterLevel(dst, c.opts.Level)
+			}
+			return &pooledWriter{encoder: gz, pool: &c.gzipPool}
+		}
+
+		zw, ok := c.zlibPool.Get().(*zlib.Writer)
+		if ok {
+			zw.Reset(dst)
+		} else {
+			zw, _ = zlib.NewWriterLevel(dst, c.opts.Level)
+		}
+		return &pooledWriter{encoder: zw, pool: &c.zlibPool}
+	}
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// pooledWriter returns the encoder to its pool once closed.
+type pooledWriter struct {
+	encoder
+	pool *sync.Pool
+}
+
+func (p *pooledWriter) Close() error {
+	err := p.encoder.Close()
+	p.pool.Put(p.encoder)
+	return err
+}
@@ -0,0 +1,166 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/harry713j/http-server/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var largeBody = strings.Repeat("Your request was an absolute banger. ", 100)
+
+func fixedLength(contentType, body string) server.Handler {
+	return func(w io.Writer, r *request.Request) *server.HandlerError {
+		respWriter := response.NewWriter(w)
+		respWriter.WriteStatusLine(response.StatusOk)
+
+		h := response.GetDefaultHeaders(len(body))
+		h.Add("Content-Type", contentType)
+		respWriter.WriteHeaders(h)
+
+		respWriter.WriteBody([]byte(body))
+		return nil
+	}
+}
+
+func chunked(w io.Writer, r *request.Request) *server.HandlerError {
+	respWriter := response.NewWriter(w)
+	respWriter.WriteStatusLine(response.StatusOk)
+
+	h := response.GetDefaultHeaders(0)
+	h.Add("Content-Type", "application/json")
+	h.Add("Transfer-Encoding", "chunked")
+	respWriter.WriteHeaders(h)
+
+	for i := 0; i < 10; i++ {
+		respWriter.WriteChunkedBody([]byte(largeBody[:100]))
+	}
+	respWriter.WriteChunkedBodyDone()
+	return nil
+}
+
+func run(t *testing.T, acceptEncoding string, h server.Handler) *http.Response {
+	t.Helper()
+	return runVersion(t, "1.1", acceptEncoding, h)
+}
+
+func runVersion(t *testing.T, version, acceptEncoding string, h server.Handler) *http.Response {
+	t.Helper()
+
+	req := &request.Request{Headers: header.NewHeaders()}
+	req.RequestLine.Method = "GET"
+	req.RequestLine.HttpVersion = version
+	if acceptEncoding != "" {
+		req.Headers["accept-encoding"] = acceptEncoding
+	}
+
+	var out bytes.Buffer
+	respWriter := response.NewWriter(&out)
+	require.Nil(t, New(Options{}).Middleware(h)(respWriter, req))
+	require.NoError(t, respWriter.Finish())
+
+	resp, err := http.ReadResponse(bufio.NewReader(&out), nil)
+	require.NoError(t, err)
+	return resp
+}
+
+// Test: Fixed-length body is switched to chunked gzip
+func TestCompressGzipFixedLength(t *testing.T) {
+	resp := run(t, "gzip, deflate", fixedLength("text/html", largeBody))
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+
+	gz, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, largeBody, string(body))
+}
+
+// Test: compressed responses get a weak ETag and no Accept-Ranges
+func TestCompressValidators(t *testing.T) {
+	withValidators := func(etag string) server.Handler {
+		return func(w io.Writer, r *request.Request) *server.HandlerError {
+			respWriter := response.NewWriter(w)
+			respWriter.WriteStatusLine(response.StatusOk)
+
+			h := response.GetDefaultHeaders(len(largeBody))
+			h.Add("Content-Type", "text/html")
+			h.Add("ETag", etag)
+			h.Add("Accept-Ranges", "bytes")
+			respWriter.WriteHeaders(h)
+
+			respWriter.WriteBody([]byte(largeBody))
+			return nil
+		}
+	}
+
+	resp := run(t, "gzip", withValidators(`"v1"`))
+	assert.Equal(t, `W/"v1"`, resp.Header.Get("ETag"))
+	assert.Empty(t, resp.Header.Get("Accept-Ranges"))
+
+	resp = run(t, "deflate", withValidators(`W/"v1"`))
+	assert.Equal(t, `W/"v1"`, resp.Header.Get("ETag"))
+
+	// Test: uncompressed responses keep them
+	resp = run(t, "identity", withValidators(`"v1"`))
+	assert.Equal(t, `"v1"`, resp.Header.Get("ETag"))
+	assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+}
+
+// Test: HTTP/1.0 clients get the body as is, they can't read chunked ones
+func TestCompressSkippedForHTTP10(t *testing.T) {
+	resp := runVersion(t, "1.0", "gzip", fixedLength("text/html", largeBody))
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Empty(t, resp.TransferEncoding)
+	assert.Equal(t, int64(len(largeBody)), resp.ContentLength)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, largeBody, string(body))
+}
+
+// Test: Chunked body compressed with deflate
+func TestCompressDeflateChunked(t *testing.T) {
+	resp := run(t, "gzip;q=0.5, deflate", chunked)
+	assert.Equal(t, "deflate", resp.Header.Get("Content-Encoding"))
+
+	zr, err := zlib.NewReader(resp.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat(largeBody[:100], 10), string(body))
+}
+
+// Test: Responses that must not be compressed
+func TestCompressSkipped(t *testing.T) {
+	cases := map[string]struct {
+		acceptEncoding string
+		handler        server.Handler
+	}{
+		"no accept-encoding": {"", fixedLength("text/html", largeBody)},
+		"too small":          {"gzip", fixedLength("text/html", "tiny")},
+		"video":              {"gzip", fixedLength("video/mp4", largeBody)},
+		"unsupported coding": {"br", fixedLength("text/html", largeBody)},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			resp := run(t, c.acceptEncoding, c.handler)
+			assert.Empty(t, resp.Header.Get("Content-Encoding"))
+			assert.Empty(t, resp.TransferEncoding)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/harry713j/http-server/internal/server"
+)
+
+const (
+	DefaultMaxDecodedSize = 10 << 20
+	DefaultMaxRatio       = 100
+)
+
+var (
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+	ErrDecodedTooLarge     = errors.New("decoded body too large")
+)
+
+type DecompressOptions struct {
+	// MaxSize caps the decoded body, DefaultMaxDecodedSize when 0
+	MaxSize int
+	// MaxRatio caps decoded size / encoded size, DefaultMaxRatio when 0.
+	// Together with MaxSize it stops zip bombs early.
+	MaxRatio int
+}
+
+type Decompressor struct {
+	opts DecompressOptions
+}
+
+func NewDecompressor(opts DecompressOptions) *Decompressor {
+	if opts.MaxSize == 0 {
+		opts.MaxSize = DefaultMaxDecodedSize
+	}
+
+	if opts.MaxRatio == 0 {
+		opts.MaxRatio = DefaultMaxRatio
+	}
+
+	return &Decompressor{opts: opts}
+}
+
+// Middleware replaces a gzip or deflate encoded request body with the
+// decoded bytes before calling next, and drops Content-Encoding so next
+// sees a plain request. Unsupported codings get a 415 and oversized
+// bodies a 413.
+func (d *Decompressor) Middleware(next server.Handler) server.Handler {
+	return func(w io.Writer, r *request.Request) *server.HandlerError {
+		encoding := r.Headers.Get("Content-Encoding")
+		if encoding == "" {
+			return next(w, r)
+		}
+
+		body, err := Decode(r.Body, encoding, d.opts.MaxSize, d.opts.MaxRatio)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrUnsupportedEncoding):
+				h := header.NewHeaders()
+				h.Add("Accept-Encoding", "gzip, deflate")
+				return &server.HandlerError{StatusCode: response.StatusUnsupportedMediaType, Message: err.Error(), Headers: h}
+			case errors.Is(err, ErrDecodedTooLarge):
+				return &server.HandlerError{StatusCode: response.StatusRequestEntityTooLarge, Message: err.Error()}
+			default:
+				return &server.HandlerError{StatusCode: response.StatusBadRequest, Message: err.Error()}
+			}
+		}
+
+		r.Body = body
+		r.Headers.Remove("Content-Encoding")
+		r.Headers.Remove("Content-Length")
+		r.Headers["content-length"] = strconv.Itoa(len(body))
+
+		return next(w, r)
+	}
+}
+
+// Decode undoes the codings listed in a Content-Encoding value, last
+// applied first. The decoded size may not exceed maxSize nor maxRatio
+// times the encoded size.
+func Decode(body []byte, encoding string, maxSize, maxRatio int) ([]byte, error) {
+	codings := strings.Split(encoding, ",")
+
+	limit := maxSize
+	if ratioLimit := len(body) * maxRatio; maxRatio > 0 && ratioLimit < limit {
+		limit = ratioLimit
+	}
+
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+
+		var (
+			reader io.ReadCloser
+			err    error
+		)
+
+		switch coding {
+		case "identity", "":
+			continue
+		case "gzip", "x-gzip":
+			reader, err = gzip.NewReader(bytes.NewReader(body))
+		case "deflate":
+			reader, err = zlib.NewReader(bytes.NewReader(body))
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, coding)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s body: %v", coding, err)
+		}
+
+		decoded, err := io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s body: %v", coding, err)
+		}
+
+		if len(decoded) > limit {
+			return nil, fmt.Errorf("%w: limit is %d bytes", ErrDecodedTooLarge, limit)
+		}
+
+		body = decoded
+	}
+
+	return body, nil
+}
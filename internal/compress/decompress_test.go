@@ -0,0 +1,87 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/harry713j/http-server/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func deflated(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// Test: Decode single and stacked codings
+func TestDecode(t *testing.T) {
+	body, err := Decode(gzipped(t, "hello world"), "gzip", 1024, 100)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(body))
+
+	body, err = Decode(deflated(t, gzipped(t, "hello world")), "gzip, deflate", 1024, 100)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(body))
+
+	_, err = Decode([]byte("data"), "br", 1024, 100)
+	assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+
+	_, err = Decode([]byte("not gzip"), "gzip", 1024, 100)
+	assert.Error(t, err)
+}
+
+// Test: Zip bombs are rejected by size and ratio
+func TestDecodeLimits(t *testing.T) {
+	bomb := gzipped(t, strings.Repeat("a", 1<<20))
+
+	_, err := Decode(bomb, "gzip", 1<<10, 0)
+	assert.ErrorIs(t, err, ErrDecodedTooLarge)
+
+	_, err = Decode(bomb, "gzip", 10<<20, 10)
+	assert.ErrorIs(t, err, ErrDecodedTooLarge)
+}
+
+// Test: Middleware decodes the body or fails with 415
+func TestDecompressMiddleware(t *testing.T) {
+	var seen *request.Request
+	next := func(w io.Writer, r *request.Request) *server.HandlerError {
+		seen = r
+		return nil
+	}
+	d := NewDecompressor(DecompressOptions{})
+
+	r := &request.Request{Headers: header.NewHeaders(), Body: gzipped(t, `{"flavour":"darkmode"}`)}
+	r.Headers["content-encoding"] = "gzip"
+	require.Nil(t, d.Middleware(next)(nil, r))
+	assert.Equal(t, `{"flavour":"darkmode"}`, string(seen.Body))
+	assert.Empty(t, seen.Headers.Get("Content-Encoding"))
+	assert.Equal(t, "22", seen.Headers.Get("Content-Length"))
+
+	r = &request.Request{Headers: header.NewHeaders(), Body: []byte("data")}
+	r.Headers["content-encoding"] = "br"
+	hErr := d.Middleware(next)(nil, r)
+	require.NotNil(t, hErr)
+	assert.Equal(t, response.StatusUnsupportedMediaType, hErr.StatusCode)
+	assert.Equal(t, "gzip, deflate", hErr.Headers.Get("Accept-Encoding"))
+}
@@ -0,0 +1,325 @@
+package fileserver
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/harry713j/http-server/internal/server"
+)
+
+type Options struct {
+	// StripPrefix is removed from the request path before looking up files
+	StripPrefix string
+	// IndexFile is served for directory requests, "index.html" when empty
+	IndexFile string
+	// ListDirectories renders an HTML listing for directories without an
+	// index file instead of answering 403
+	ListDirectories bool
+	// AllowDotfiles serves files and directories starting with a dot
+	AllowDotfiles bool
+	// FollowSymlinks serves symbolic links inside the root. Links can
+	// never point outside of a root opened with Dir.
+	FollowSymlinks bool
+}
+
+// FileServer serves files from an fs.FS, e.g. Dir("./public") or an
+// embed.FS.
+type FileServer struct {
+	fsys fs.FS
+	opts Options
+}
+
+func New(fsys fs.FS, opts Options) *FileServer {
+	if opts.IndexFile == "" {
+		opts.IndexFile = "index.html"
+	}
+
+	return &FileServer{fsys: fsys, opts: opts}
+}
+
+// Dir opens root as an fs.FS that refuses to resolve paths, including
+// symlink targets, outside of root.
+func Dir(root string) (fs.FS, error) {
+	r, err := os.OpenRoot(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open root %s: %v", root, err)
+	}
+
+	return r.FS(), nil
+}
+
+// Handle is a server.Handler serving the file named by the request path.
+func (f *FileServer) Handle(w io.Writer, r *request.Request) *server.HandlerError {
+	if hErr := checkMethod(r); hErr != nil {
+		return hErr
+	}
+
+	urlPath, query, _ := strings.Cut(r.RequestLine.RequestTarget, "?")
+
+	urlPath, err := url.PathUnescape(urlPath)
+	if err != nil || strings.ContainsAny(urlPath, "\x00\\") {
+		return &server.HandlerError{StatusCode: response.StatusBadRequest, Message: "invalid path"}
+	}
+
+	if f.opts.StripPrefix != "" {
+		trimmed, ok := strings.CutPrefix(urlPath, f.opts.StripPrefix)
+		if !ok {
+			return notFound()
+		}
+		urlPath = trimmed
+	}
+
+	// Clean resolves every ".." against the root, so nothing above it can
+	// be named
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		name = "."
+	}
+
+	if !fs.ValidPath(name) {
+		return notFound()
+	}
+
+	if hErr := f.checkPath(name); hErr != nil {
+		return hErr
+	}
+
+	info, err := fs.Stat(f.fsys, name)
+	if err != nil {
+		return fsError(err)
+	}
+
+	if !info.IsDir() {
+		return serveFile(w, r, f.fsys, name)
+	}
+
+	// relative links in the index page or listing need the trailing slash
+	if !strings.HasSuffix(urlPath, "/") {
+		location := r.RequestLine.RequestTarget
+		location, _, _ = strings.Cut(location, "?")
+		location += "/"
+		if query != "" {
+			location += "?" + query
+		}
+		return redirect(w, location)
+	}
+
+	index := path.Join(name, f.opts.IndexFile)
+	if indexInfo, err := fs.Stat(f.fsys, index); err == nil && indexInfo.Mode().IsRegular() {
+		if hErr := f.checkPath(index); hErr == nil {
+			return serveFile(w, r, f.fsys, index)
+		}
+	}
+
+	if !f.opts.ListDirectories {
+		return &server.HandlerError{StatusCode: response.StatusForbidden, Message: "directory listing is disabled"}
+	}
+
+	return f.listDirectory(w, r, name, urlPath)
+}
+
+// checkPath rejects dotfiles and symlinks along the path unless allowed.
+func (f *FileServer) checkPath(name string) *server.HandlerError {
+	if name == "." {
+		return nil
+	}
+
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		if !f.opts.AllowDotfiles && strings.HasPrefix(segment, ".") {
+			return notFound()
+		}
+
+		if f.opts.FollowSymlinks {
+			continue
+		}
+
+		info, err := fs.Lstat(f.fsys, strings.Join(segments[:i+1], "/"))
+		if err != nil {
+			return fsError(err)
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return notFound()
+		}
+	}
+
+	return nil
+}
+
+// ServeFile serves the single file name from fsys, e.g. for a fixed route.
+func ServeFile(w io.Writer, r *request.Request, fsys fs.FS, name string) *server.HandlerError {
+	if hErr := checkMethod(r); hErr != nil {
+		return hErr
+	}
+
+	return serveFile(w, r, fsys, name)
+}
+
+func serveFile(w io.Writer, r *request.Request, fsys fs.FS, name string) *server.HandlerError {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return fsError(err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fsError(err)
+	}
+
+	if !info.Mode().IsRegular() {
+		return notFound()
+	}
+
+	contentType, body, err := detectContentType(name, file)
+	if err != nil {
+		return internalError(err)
+	}
+
+	respWriter := response.NewWriter(w)
+	headers := response.GetDefaultHeaders(int(info.Size()))
+	headers.Add("Content-Type", contentType)
+
+	if hErr := addValidators(headers, fsys, name, info, body); hErr != nil {
+		return hErr
+	}
+
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		if err := response.ServeContent(respWriter, r.Headers, r.RequestLine.Method, seeker, info.Size(), headers); err != nil {
+			return internalError(err)
+		}
+		return nil
+	}
+
+	if done, err := response.EvaluatePreconditions(respWriter, r.Headers, headers, r.RequestLine.Method); done {
+		if err != nil {
+			return internalError(err)
+		}
+		return nil
+	}
+
+	if err := respWriter.WriteStatusLine(response.StatusOk); err != nil {
+		return internalError(err)
+	}
+
+	if err := respWriter.WriteHeaders(headers); err != nil {
+		return internalError(err)
+	}
+
+	if r.RequestLine.Method == "HEAD" {
+		return nil
+	}
+
+	if _, err := respWriter.WriteBodyFrom(body); err != nil {
+		return internalError(err)
+	}
+
+	return nil
+}
+
+// embedETags caches the content hash ETags of embed.FS files, which never
+// change, by embedFile.
+var embedETags sync.Map
+
+type embedFile struct {
+	fsys embed.FS
+	name string
+}
+
+// addValidators sets Last-Modified and an ETag from the modification time
+// and size. Files without one, such as embed.FS files, get a content hash
+// ETag instead when the body can be rewound.
+func addValidators(headers header.Headers, fsys fs.FS, name string, info fs.FileInfo, body io.Reader) *server.HandlerError {
+	if !info.ModTime().IsZero() {
+		headers.Add("Last-Modified", info.ModTime().UTC().Format(header.TimeFormat))
+		headers.Add("ETag", response.ModTimeETag(info.ModTime(), info.Size(), false))
+		return nil
+	}
+
+	seeker, ok := body.(io.ReadSeeker)
+	if !ok {
+		return nil
+	}
+
+	embedded, cacheable := fsys.(embed.FS)
+	if cacheable {
+		if etag, ok := embedETags.Load(embedFile{embedded, name}); ok {
+			headers.Add("ETag", etag.(string))
+			return nil
+		}
+	}
+
+	etag, err := response.HashReaderETag(seeker)
+	if err != nil {
+		return internalError(err)
+	}
+
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return internalError(err)
+	}
+
+	if cacheable {
+		embedETags.Store(embedFile{embedded, name}, etag)
+	}
+	headers.Add("ETag", etag)
+	return nil
+}
+
+func checkMethod(r *request.Request) *server.HandlerError {
+	if r.RequestLine.Method == "GET" || r.RequestLine.Method == "HEAD" {
+		return nil
+	}
+
+	h := header.NewHeaders()
+	h.Add("Allow", "GET, HEAD")
+	return &server.HandlerError{StatusCode: response.StatusMethodNotAllowed, Message: "method not allowed", Headers: h}
+}
+
+func redirect(w io.Writer, location string) *server.HandlerError {
+	respWriter := response.NewWriter(w)
+
+	if err := respWriter.WriteStatusLine(response.StatusMovedPermanently); err != nil {
+		return internalError(err)
+	}
+
+	headers := response.GetDefaultHeaders(0)
+	headers.Add("Location", location)
+
+	if err := respWriter.WriteHeaders(headers); err != nil {
+		return internalError(err)
+	}
+
+	return nil
+}
+
+func notFound() *server.HandlerError {
+	return &server.HandlerError{StatusCode: response.StatusNotFound, Message: "file not found"}
+}
+
+func internalError(err error) *server.HandlerError {
+	return &server.HandlerError{StatusCode: response.StatusInternalServerError, Message: "failed to serve file", Cause: err}
+}
+
+func fsError(err error) *server.HandlerError {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return notFound()
+	case errors.Is(err, fs.ErrPermission):
+		return &server.HandlerError{StatusCode: response.StatusForbidden, Message: "permission denied"}
+	default:
+		// os.Root reports paths escaping the root as plain errors
+		return &server.HandlerError{StatusCode: response.StatusNotFound, Message: "file not found", Cause: err}
+	}
+}
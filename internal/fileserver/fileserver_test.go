@@ -0,0 +1,277 @@
+package fileserver
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/harry713j/http-server/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFS = fstest.MapFS{
+	"index.html":       {Data: []byte("<h1>home</h1>")},
+	"docs/readme":      {Data: []byte("plain text readme")},
+	"docs/guide.md":    {Data: []byte("# guide")},
+	"media/clip":       {Data: []byte("\x00\x00\x00\x0cftypmp42")},
+	".env":             {Data: []byte("SECRET=1")},
+	"empty/.gitignore": {Data: []byte("")},
+}
+
+//go:embed testdata
+var embedFS embed.FS
+
+func get(t *testing.T, h server.Handler, method, target string, reqHeaders ...string) (*http.Response, string, *server.HandlerError) {
+	t.Helper()
+
+	req := &request.Request{Headers: header.NewHeaders()}
+	req.RequestLine.Method = method
+	req.RequestLine.RequestTarget = target
+	for i := 0; i+1 < len(reqHeaders); i += 2 {
+		req.Headers[strings.ToLower(reqHeaders[i])] = reqHeaders[i+1]
+	}
+
+	var out bytes.Buffer
+	hErr := h(response.NewWriter(&out), req)
+	if hErr != nil {
+		return nil, "", hErr
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(&out), &http.Request{Method: method})
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body), nil
+}
+
+// Test: Files, index and MIME detection
+func TestServeFiles(t *testing.T) {
+	fsrv := New(testFS, Options{StripPrefix: "/static"})
+
+	resp, body, hErr := get(t, fsrv.Handle, "GET", "/static/")
+	require.Nil(t, hErr)
+	assert.Equal(t, "<h1>home</h1>", body)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	resp, body, hErr = get(t, fsrv.Handle, "GET", "/static/docs/readme?x=1")
+	require.Nil(t, hErr)
+	assert.Equal(t, "plain text readme", body)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	resp, _, hErr = get(t, fsrv.Handle, "GET", "/static/media/clip")
+	require.Nil(t, hErr)
+	assert.Equal(t, "video/mp4", resp.Header.Get("Content-Type"))
+
+	resp, body, hErr = get(t, fsrv.Handle, "HEAD", "/static/docs/readme")
+	require.Nil(t, hErr)
+	assert.Equal(t, int64(17), resp.ContentLength)
+	assert.Empty(t, body)
+}
+
+// Test: Directories redirect, list or are forbidden
+func TestServeDirectories(t *testing.T) {
+	fsrv := New(testFS, Options{})
+
+	resp, _, hErr := get(t, fsrv.Handle, "GET", "/docs?sort=name")
+	require.Nil(t, hErr)
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	assert.Equal(t, "/docs/?sort=name", resp.Header.Get("Location"))
+
+	_, _, hErr = get(t, fsrv.Handle, "GET", "/docs/")
+	require.NotNil(t, hErr)
+	assert.Equal(t, response.StatusForbidden, hErr.StatusCode)
+
+	listing := New(testFS, Options{ListDirectories: true})
+	_, body, hErr := get(t, listing.Handle, "GET", "/docs/")
+	require.Nil(t, hErr)
+	assert.Contains(t, body, `<a href="guide.md">guide.md</a>`)
+	assert.Contains(t, body, `<a href="readme">readme</a>`)
+
+	_, body, hErr = get(t, listing.Handle, "GET", "/empty/")
+	require.Nil(t, hErr)
+	assert.NotContains(t, body, ".gitignore")
+}
+
+// Test: Rejected paths and methods
+func TestServeRejected(t *testing.T) {
+	fsrv := New(testFS, Options{})
+
+	for _, target := range []string{"/.env", "/../index.html/x", "/missing", "/%2e%2e/%2e%2e/etc/passwd"} {
+		_, _, hErr := get(t, fsrv.Handle, "GET", target)
+		require.NotNil(t, hErr, target)
+		assert.Equal(t, response.StatusNotFound, hErr.StatusCode, target)
+	}
+
+	_, _, hErr := get(t, fsrv.Handle, "POST", "/index.html")
+	require.NotNil(t, hErr)
+	assert.Equal(t, response.StatusMethodNotAllowed, hErr.StatusCode)
+	assert.Equal(t, "GET, HEAD", hErr.Headers.Get("Allow"))
+}
+
+// Test: Symlinks are refused, and can never escape the root
+func TestServeSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o600))
+
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("inside"), 0o600))
+	require.NoError(t, os.Symlink("file.txt", filepath.Join(root, "link.txt")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret"), filepath.Join(root, "escape")))
+
+	fsys, err := Dir(root)
+	require.NoError(t, err)
+
+	fsrv := New(fsys, Options{})
+	_, _, hErr := get(t, fsrv.Handle, "GET", "/link.txt")
+	require.NotNil(t, hErr)
+	assert.Equal(t, response.StatusNotFound, hErr.StatusCode)
+
+	follow := New(fsys, Options{FollowSymlinks: true})
+	_, body, hErr := get(t, follow.Handle, "GET", "/link.txt")
+	require.Nil(t, hErr)
+	assert.Equal(t, "inside", body)
+
+	_, _, hErr = get(t, follow.Handle, "GET", "/escape")
+	require.NotNil(t, hErr)
+	assert.Equal(t, response.StatusNotFound, hErr.StatusCode)
+}
+
+// Test: Single, multiple and unsatisfiable byte ranges
+func TestServeRanges(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "digits.txt"), []byte("0123456789"), 0o600))
+
+	fsys, err := Dir(root)
+	require.NoError(t, err)
+	fsrv := New(fsys, Options{})
+
+	resp, body, hErr := get(t, fsrv.Handle, "GET", "/digits.txt")
+	require.Nil(t, hErr)
+	assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+	assert.Equal(t, "0123456789", body)
+
+	resp, body, hErr = get(t, fsrv.Handle, "GET", "/digits.txt", "Range", "bytes=2-4")
+	require.Nil(t, hErr)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "bytes 2-4/10", resp.Header.Get("Content-Range"))
+	assert.Equal(t, "234", body)
+
+	resp, body, hErr = get(t, fsrv.Handle, "GET", "/digits.txt", "Range", "bytes=0-1,-2")
+	require.Nil(t, hErr)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "multipart/byteranges; boundary="))
+	assert.Equal(t, int64(len(body)), resp.ContentLength)
+	assert.Contains(t, body, "Content-Range: bytes 0-1/10\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n01\r\n")
+	assert.Contains(t, body, "Content-Range: bytes 8-9/10\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n89\r\n")
+
+	resp, _, hErr = get(t, fsrv.Handle, "GET", "/digits.txt", "Range", "bytes=20-")
+	require.Nil(t, hErr)
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.StatusCode)
+	assert.Equal(t, "bytes */10", resp.Header.Get("Content-Range"))
+
+	// a stale If-Range means the full content
+	resp, body, hErr = get(t, fsrv.Handle, "GET", "/digits.txt", "Range", "bytes=2-4", "If-Range", `"stale"`)
+	require.Nil(t, hErr)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "0123456789", body)
+}
+
+// Test: Conditional requests answer 304 and 412
+func TestServeConditional(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "page.html")
+	require.NoError(t, os.WriteFile(file, []byte("<p>cached</p>"), 0o600))
+	modTime := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(file, modTime, modTime))
+
+	fsys, err := Dir(root)
+	require.NoError(t, err)
+	fsrv := New(fsys, Options{})
+
+	resp, _, hErr := get(t, fsrv.Handle, "GET", "/page.html")
+	require.Nil(t, hErr)
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, "Sat, 01 Jun 2024 12:00:00 GMT", resp.Header.Get("Last-Modified"))
+
+	resp, body, hErr := get(t, fsrv.Handle, "GET", "/page.html", "If-None-Match", `"other", `+etag)
+	require.Nil(t, hErr)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+	assert.Empty(t, body)
+
+	resp, _, hErr = get(t, fsrv.Handle, "GET", "/page.html", "If-Modified-Since", "Sat, 01 Jun 2024 12:00:00 GMT")
+	require.Nil(t, hErr)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	resp, _, hErr = get(t, fsrv.Handle, "GET", "/page.html", "If-Modified-Since", "Fri, 31 May 2024 12:00:00 GMT")
+	require.Nil(t, hErr)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// If-None-Match takes precedence over If-Modified-Since
+	resp, _, hErr = get(t, fsrv.Handle, "GET", "/page.html", "If-None-Match", `"other"`, "If-Modified-Since", "Sat, 01 Jun 2024 12:00:00 GMT")
+	require.Nil(t, hErr)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _, hErr = get(t, fsrv.Handle, "GET", "/page.html", "If-Match", `"other"`)
+	require.Nil(t, hErr)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, _, hErr = get(t, fsrv.Handle, "GET", "/page.html", "If-Unmodified-Since", "Fri, 31 May 2024 12:00:00 GMT")
+	require.Nil(t, hErr)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	// If-Range with the current ETag honors the range
+	resp, body, hErr = get(t, fsrv.Handle, "GET", "/page.html", "Range", "bytes=0-2", "If-Range", etag)
+	require.Nil(t, hErr)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "<p>", body)
+}
+
+// Test: Files without a modification time get a content hash ETag
+func TestServeHashETag(t *testing.T) {
+	fsrv := New(testFS, Options{})
+
+	resp, _, hErr := get(t, fsrv.Handle, "GET", "/docs/readme")
+	require.Nil(t, hErr)
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, response.HashETag([]byte("plain text readme")), etag)
+	assert.Empty(t, resp.Header.Get("Last-Modified"))
+
+	resp, _, hErr = get(t, fsrv.Handle, "HEAD", "/docs/readme", "If-None-Match", etag)
+	require.Nil(t, hErr)
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+}
+
+// Test: embed.FS files get their content hash ETag once, later requests
+// take it from the cache
+func TestServeEmbedETag(t *testing.T) {
+	fsrv := New(embedFS, Options{})
+
+	resp, body, hErr := get(t, fsrv.Handle, "GET", "/testdata/hello.txt")
+	require.Nil(t, hErr)
+	assert.Equal(t, "embedded hello\n", body)
+	etag := resp.Header.Get("ETag")
+	assert.Equal(t, response.HashETag([]byte("embedded hello\n")), etag)
+
+	cached, ok := embedETags.Load(embedFile{embedFS, "testdata/hello.txt"})
+	require.True(t, ok)
+	assert.Equal(t, etag, cached)
+
+	resp, body, hErr = get(t, fsrv.Handle, "GET", "/testdata/hello.txt")
+	require.Nil(t, hErr)
+	assert.Equal(t, "embedded hello\n", body)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+}
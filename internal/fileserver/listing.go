@@ -0,0 +1,100 @@
+package fileserver
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/url"
+	"strings"
+
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/harry713j/http-server/internal/server"
+)
+
+type listingEntry struct {
+	Name string
+	Href string
+	Size int64
+	Dir  bool
+}
+
+var listingPage = template.Must(template.New("listing").Parse(`<html>
+	<head>
+		<title>Index of {{.Path}}</title>
+	</head>
+	<body>
+		<h1>Index of {{.Path}}</h1>
+		<ul>
+			<li><a href="../">../</a></li>
+			{{- range .Entries}}
+			<li><a href="{{.Href}}">{{.Name}}{{if .Dir}}/{{end}}</a>{{if not .Dir}} ({{.Size}} bytes){{end}}</li>
+			{{- end}}
+		</ul>
+	</body>
+</html>
+`))
+
+func (f *FileServer) listDirectory(w io.Writer, r *request.Request, name, urlPath string) *server.HandlerError {
+	entries, err := fs.ReadDir(f.fsys, name)
+	if err != nil {
+		return fsError(err)
+	}
+
+	listing := []listingEntry{}
+	for _, e := range entries {
+		if !f.opts.AllowDotfiles && strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		if !f.opts.FollowSymlinks && e.Type()&fs.ModeSymlink != 0 {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		href := url.PathEscape(e.Name())
+		if e.IsDir() {
+			href += "/"
+		}
+
+		listing = append(listing, listingEntry{Name: e.Name(), Href: href, Size: info.Size(), Dir: e.IsDir()})
+	}
+
+	var body bytes.Buffer
+	data := struct {
+		Path    string
+		Entries []listingEntry
+	}{Path: urlPath, Entries: listing}
+
+	if err := listingPage.Execute(&body, data); err != nil {
+		return internalError(err)
+	}
+
+	respWriter := response.NewWriter(w)
+
+	if err := respWriter.WriteStatusLine(response.StatusOk); err != nil {
+		return internalError(err)
+	}
+
+	headers := response.GetDefaultHeaders(body.Len())
+	headers.Add("Content-Type", "text/html; charset=utf-8")
+
+	if err := respWriter.WriteHeaders(headers); err != nil {
+		return internalError(err)
+	}
+
+	if r.RequestLine.Method == "HEAD" {
+		return nil
+	}
+
+	if _, err := respWriter.WriteBody(body.Bytes()); err != nil {
+		return internalError(err)
+	}
+
+	return nil
+}
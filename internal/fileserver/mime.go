@@ -0,0 +1,39 @@
+package fileserver
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+)
+
+const sniffLen = 512
+
+// detectContentType uses the file extension and falls back to sniffing
+// the first 512 bytes. It returns a reader positioned at the start of the
+// file.
+func detectContentType(name string, file fs.File) (string, io.Reader, error) {
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		return contentType, file, nil
+	}
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", nil, err
+	}
+	buf = buf[:n]
+
+	contentType := http.DetectContentType(buf)
+
+	if seeker, ok := file.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return "", nil, err
+		}
+		return contentType, file, nil
+	}
+
+	return contentType, io.MultiReader(bytes.NewReader(buf), file), nil
+}
@@ -0,0 +1,226 @@
+// Package forwarded resolves the original client, scheme and host of
+// requests that came through reverse proxies, from the RFC 7239 Forwarded
+// header or the X-Forwarded-For, -Proto and -Host headers.
+package forwarded
+
+import (
+	"io"
+	"net/netip"
+	"strings"
+
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/server"
+)
+
+type Options struct {
+	// Trusted are the proxies whose headers are believed. Headers are only
+	// read when the connection comes from a trusted proxy, and the hops it
+	// reports are followed back until one that is not trusted: that is the
+	// client.
+	Trusted []netip.Prefix
+}
+
+// Resolver sets Request.Forwarded from the headers of trusted proxies.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+func New(opts Options) *Resolver {
+	return &Resolver{trusted: opts.Trusted}
+}
+
+// hop is one proxy's report of where the request came from.
+type hop struct {
+	node  string // the "for" value
+	proto string
+	host  string
+}
+
+// Middleware resolves the client before calling next. Requests without
+// forwarding headers or from untrusted peers are passed on unchanged.
+func (res *Resolver) Middleware(next server.Handler) server.Handler {
+	return func(w io.Writer, r *request.Request) *server.HandlerError {
+		if fwd := res.resolve(r); fwd != nil {
+			r.Forwarded = fwd
+		}
+		return next(w, r)
+	}
+}
+
+func (res *Resolver) resolve(r *request.Request) *request.Forwarded {
+	if !res.trusts(r.ClientIP()) {
+		return nil
+	}
+
+	var hops []hop
+	if v := r.Headers.Get("Forwarded"); v != "" {
+		hops = parseForwarded(v)
+	} else if v := r.Headers.Get("X-Forwarded-For"); v != "" {
+		hops = parseXForwarded(v, r.Headers.Get("X-Forwarded-Proto"), r.Headers.Get("X-Forwarded-Host"))
+	}
+
+	// proxies append their hop, so walk from the closest one back
+	var fwd *request.Forwarded
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, ok := parseNode(hops[i].node)
+		if !ok {
+			break // "unknown" or obfuscated, nothing before it can be checked
+		}
+
+		fwd = &request.Forwarded{For: ip, Proto: parseProto(hops[i].proto), Host: parseHost(hops[i].host)}
+		if !res.trusts(ip) {
+			break
+		}
+	}
+	return fwd
+}
+
+func (res *Resolver) trusts(ip netip.Addr) bool {
+	if !ip.IsValid() {
+		return false
+	}
+
+	for _, prefix := range res.trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseForwarded reads the elements of a Forwarded header, like
+//
+//	for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8::1]:4711"
+func parseForwarded(v string) []hop {
+	var hops []hop
+	for _, element := range splitQuoted(v, ',') {
+		var h hop
+		for _, pair := range splitQuoted(element, ';') {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				continue
+			}
+
+			value = unquote(strings.TrimSpace(value))
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "for":
+				h.node = value
+			case "proto":
+				h.proto = value
+			case "host":
+				h.host = value
+			}
+		}
+		hops = append(hops, h)
+	}
+	return hops
+}
+
+// parseXForwarded lines the X-Forwarded-Proto and -Host values up with
+// the X-Forwarded-For hops from the left, where the first proxy added
+// them.
+func parseXForwarded(fors, protos, hosts string) []hop {
+	protoList := splitList(protos)
+	hostList := splitList(hosts)
+
+	var hops []hop
+	for i, node := range splitList(fors) {
+		h := hop{node: node}
+		if i < len(protoList) {
+			h.proto = protoList[i]
+		}
+		if i < len(hostList) {
+			h.host = hostList[i]
+		}
+		hops = append(hops, h)
+	}
+	return hops
+}
+
+func splitList(v string) []string {
+	if v == "" {
+		return nil
+	}
+
+	list := strings.Split(v, ",")
+	for i := range list {
+		list[i] = strings.TrimSpace(list[i])
+	}
+	return list
+}
+
+// splitQuoted splits v at sep outside of quoted strings.
+func splitQuoted(v string, sep byte) []string {
+	var parts []string
+	inQuotes, start := false, 0
+
+	for i := 0; i < len(v); i++ {
+		switch {
+		case v[i] == '\\' && inQuotes:
+			i++ // skip the escaped character
+		case v[i] == '"':
+			inQuotes = !inQuotes
+		case v[i] == sep && !inQuotes:
+			parts = append(parts, strings.TrimSpace(v[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(v[start:]))
+}
+
+func unquote(v string) string {
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return v
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(v)-1; i++ {
+		if v[i] == '\\' && i+1 < len(v)-1 {
+			i++
+		}
+		b.WriteByte(v[i])
+	}
+	return b.String()
+}
+
+// parseNode reads an address with an optional port: 192.0.2.60,
+// 192.0.2.60:8080, [2001:db8::1], [2001:db8::1]:4711 or a bare IPv6
+// address as X-Forwarded-For carries them.
+func parseNode(node string) (netip.Addr, bool) {
+	if ip, err := netip.ParseAddr(node); err == nil {
+		return ip.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(node); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	if inner, ok := strings.CutPrefix(node, "["); ok {
+		if inner, ok := strings.CutSuffix(inner, "]"); ok {
+			if ip, err := netip.ParseAddr(inner); err == nil {
+				return ip.Unmap(), true
+			}
+		}
+	}
+	return netip.Addr{}, false
+}
+
+func parseProto(proto string) string {
+	switch proto = strings.ToLower(proto); proto {
+	case "http", "https":
+		return proto
+	default:
+		return ""
+	}
+}
+
+// parseHost drops values that can't be a host[:port].
+func parseHost(host string) string {
+	if host == "" || strings.ContainsAny(host, " \t/\\@") {
+		return ""
+	}
+	for _, c := range host {
+		if c < 0x21 || c > 0x7e {
+			return ""
+		}
+	}
+	return host
+}
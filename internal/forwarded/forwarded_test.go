@@ -0,0 +1,119 @@
+package forwarded
+
+import (
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRequest builds a request from peer carrying headers.
+func newRequest(peer string, headers header.Headers) *request.Request {
+	r := &request.Request{Headers: header.NewHeaders()}
+	for k, v := range headers {
+		r.Headers[k] = v
+	}
+	r.Conn = &request.ConnInfo{RemoteAddr: net.TCPAddrFromAddrPort(netip.AddrPortFrom(netip.MustParseAddr(peer), 40000))}
+	return r
+}
+
+// resolve runs r through the middleware and returns what the handler saw.
+func resolve(t *testing.T, r *request.Request) (ip, scheme, host string) {
+	t.Helper()
+
+	res := New(Options{Trusted: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8:ffff::/48"),
+	}})
+
+	called := false
+	handler := res.Middleware(func(w io.Writer, r *request.Request) *server.HandlerError {
+		called = true
+		ip, scheme, host = r.ClientIP().String(), r.Scheme(), r.Host()
+		return nil
+	})
+	require.Nil(t, handler(io.Discard, r))
+	require.True(t, called)
+	return ip, scheme, host
+}
+
+func TestForwarded(t *testing.T) {
+	// Test: the hop before the trusted proxy is the client
+	ip, scheme, host := resolve(t, newRequest("10.0.0.1", header.Headers{
+		"forwarded": `for=192.0.2.60;proto=https;host=example.com, for=10.0.0.2`,
+		"host":      "backend",
+	}))
+	assert.Equal(t, "192.0.2.60", ip)
+	assert.Equal(t, "https", scheme)
+	assert.Equal(t, "example.com", host)
+
+	// Test: hops the client added before an untrusted one are ignored
+	ip, _, _ = resolve(t, newRequest("10.0.0.1", header.Headers{
+		"forwarded": `for=1.2.3.4, for=192.0.2.60`,
+	}))
+	assert.Equal(t, "192.0.2.60", ip)
+
+	// Test: quoted IPv6 nodes with ports and mixed case keys
+	ip, scheme, _ = resolve(t, newRequest("10.0.0.1", header.Headers{
+		"forwarded": `For="[2001:db8::1]:4711";Proto=HTTP`,
+	}))
+	assert.Equal(t, "2001:db8::1", ip)
+	assert.Equal(t, "http", scheme)
+
+	// Test: an obfuscated node ends the walk at the proxy that reported it
+	ip, _, _ = resolve(t, newRequest("10.0.0.1", header.Headers{
+		"forwarded": `for=_hidden, for=10.0.0.2`,
+	}))
+	assert.Equal(t, "10.0.0.2", ip)
+
+	// Test: an untrusted peer's headers are ignored
+	ip, scheme, host = resolve(t, newRequest("192.0.2.99", header.Headers{
+		"forwarded": `for=1.2.3.4;proto=https;host=evil.example`,
+		"host":      "backend",
+	}))
+	assert.Equal(t, "192.0.2.99", ip)
+	assert.Equal(t, "http", scheme)
+	assert.Equal(t, "backend", host)
+}
+
+func TestXForwarded(t *testing.T) {
+	// Test: X-Forwarded-Proto and -Host line up with X-Forwarded-For
+	ip, scheme, host := resolve(t, newRequest("10.0.0.1", header.Headers{
+		"x-forwarded-for":   "1.2.3.4, 192.0.2.60, 10.0.0.2",
+		"x-forwarded-proto": "http, https, http",
+		"x-forwarded-host":  "spoofed.example, example.com, backend",
+	}))
+	assert.Equal(t, "192.0.2.60", ip)
+	assert.Equal(t, "https", scheme)
+	assert.Equal(t, "example.com", host)
+
+	// Test: bare IPv6 addresses, IPv4-mapped peers and junk values
+	ip, scheme, host = resolve(t, newRequest("::ffff:10.0.0.1", header.Headers{
+		"x-forwarded-for":   "2001:db8::1",
+		"x-forwarded-proto": "gopher",
+		"x-forwarded-host":  "a b",
+		"host":              "backend",
+	}))
+	assert.Equal(t, "2001:db8::1", ip)
+	assert.Equal(t, "http", scheme)
+	assert.Equal(t, "backend", host)
+
+	// Test: Forwarded takes precedence
+	ip, _, _ = resolve(t, newRequest("10.0.0.1", header.Headers{
+		"forwarded":       "for=192.0.2.60",
+		"x-forwarded-for": "192.0.2.61",
+	}))
+	assert.Equal(t, "192.0.2.60", ip)
+
+	// Test: a chain of trusted proxies resolves to the first hop
+	ip, _, _ = resolve(t, newRequest("10.0.0.1", header.Headers{
+		"x-forwarded-for": "2001:db8:ffff::1, 10.0.0.3",
+	}))
+	assert.Equal(t, "2001:db8:ffff::1", ip)
+}
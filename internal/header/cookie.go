@@ -0,0 +1,259 @@
+package header
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SameSite int
+
+const (
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+// Cookie is a single cookie, either parsed from a Cookie request header
+// (only Name and Value are set) or built for a Set-Cookie response header.
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path    string
+	Domain  string
+	Expires time.Time
+	// MaxAge == 0 means no Max-Age attribute, MaxAge < 0 means delete
+	// the cookie now (Max-Age=0), MaxAge > 0 is the lifetime in seconds
+	MaxAge      int
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+var (
+	ErrInvalidCookieName   = errors.New("invalid cookie name")
+	ErrInvalidCookieValue  = errors.New("invalid cookie value")
+	ErrInvalidCookieDomain = errors.New("invalid cookie domain")
+	ErrInvalidCookiePath   = errors.New("invalid cookie path")
+	ErrCookieNotSecure     = errors.New("cookie attribute requires Secure")
+)
+
+// ParseCookies parses the value of a Cookie header into name/value pairs.
+// Pairs are separated by ';', and also by ',' since duplicate Cookie
+// headers are joined with ", " by Headers.Parse.
+func ParseCookies(line string) ([]*Cookie, error) {
+	cookies := []*Cookie{}
+
+	parts := strings.FieldsFunc(line, func(r rune) bool {
+		return r == ';' || r == ','
+	})
+
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid cookie pair %q", part)
+		}
+
+		if !isValidCookieName(name) {
+			return nil, ErrInvalidCookieName
+		}
+
+		value, ok = parseCookieValue(value)
+		if !ok {
+			return nil, ErrInvalidCookieValue
+		}
+
+		cookies = append(cookies, &Cookie{Name: name, Value: value})
+	}
+
+	return cookies, nil
+}
+
+// Cookies returns the cookies sent in the Cookie header. Malformed pairs
+// are skipped instead of failing the whole header.
+func (h Headers) Cookies() []*Cookie {
+	cookies := []*Cookie{}
+
+	line := h.Get("Cookie")
+	if line == "" {
+		return cookies
+	}
+
+	for _, part := range strings.FieldsFunc(line, func(r rune) bool {
+		return r == ';' || r == ','
+	}) {
+		parsed, err := ParseCookies(part)
+		if err != nil {
+			continue
+		}
+		cookies = append(cookies, parsed...)
+	}
+
+	return cookies
+}
+
+// Valid reports whether the cookie can be sent in a Set-Cookie header.
+func (c *Cookie) Valid() error {
+	if c == nil || !isValidCookieName(c.Name) {
+		return ErrInvalidCookieName
+	}
+
+	for i := 0; i < len(c.Value); i++ {
+		if !isCookieOctet(c.Value[i]) {
+			return ErrInvalidCookieValue
+		}
+	}
+
+	for i := 0; i < len(c.Path); i++ {
+		if c.Path[i] < 0x20 || c.Path[i] == 0x7f || c.Path[i] == ';' {
+			return ErrInvalidCookiePath
+		}
+	}
+
+	if c.Domain != "" && !isValidCookieDomain(c.Domain) {
+		return ErrInvalidCookieDomain
+	}
+
+	if (c.Partitioned || c.SameSite == SameSiteNone) && !c.Secure {
+		return ErrCookieNotSecure
+	}
+
+	// __Secure- and __Host- prefixes come with extra rules browsers enforce
+	if strings.HasPrefix(c.Name, "__Secure-") && !c.Secure {
+		return ErrCookieNotSecure
+	}
+
+	if strings.HasPrefix(c.Name, "__Host-") && (!c.Secure || c.Domain != "" || c.Path != "/") {
+		return fmt.Errorf("__Host- cookie must be Secure, have Path=/ and no Domain")
+	}
+
+	return nil
+}
+
+// String serializes the cookie as a Set-Cookie header value.
+func (c *Cookie) String() string {
+	var b strings.Builder
+
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	b.WriteString(c.Value)
+
+	if c.Path != "" {
+		b.WriteString("; Path=")
+		b.WriteString(c.Path)
+	}
+
+	if c.Domain != "" {
+		b.WriteString("; Domain=")
+		b.WriteString(strings.TrimPrefix(c.Domain, "."))
+	}
+
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=")
+		b.WriteString(c.Expires.UTC().Format(TimeFormat))
+	}
+
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=")
+		b.WriteString(strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+
+	switch c.SameSite {
+	case SameSiteLax:
+		b.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		b.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		b.WriteString("; SameSite=None")
+	}
+
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+
+	return b.String()
+}
+
+// TimeFormat is the IMF-fixdate format used by HTTP dates.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+func isValidCookieName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, r := range name {
+		if !isTokenRune(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isTokenRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+		strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+}
+
+// cookie-octet from RFC 6265: US-ASCII excluding CTLs, whitespace,
+// DQUOTE, comma, semicolon and backslash
+func isCookieOctet(b byte) bool {
+	return b == 0x21 || (b >= 0x23 && b <= 0x2b) || (b >= 0x2d && b <= 0x3a) ||
+		(b >= 0x3c && b <= 0x5b) || (b >= 0x5d && b <= 0x7e)
+}
+
+func parseCookieValue(value string) (string, bool) {
+	if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+
+	for i := 0; i < len(value); i++ {
+		if !isCookieOctet(value[i]) {
+			return "", false
+		}
+	}
+
+	return value, true
+}
+
+func isValidCookieDomain(domain string) bool {
+	domain = strings.TrimPrefix(domain, ".")
+	if domain == "" || len(domain) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, r := range label {
+			if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,81 @@
+package header
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test: Parse multiple cookie pairs
+func TestParseCookies(t *testing.T) {
+	cookies, err := ParseCookies(`session=abc123; theme="dark"; empty=`)
+	require.NoError(t, err)
+	require.Len(t, cookies, 3)
+	assert.Equal(t, "session", cookies[0].Name)
+	assert.Equal(t, "abc123", cookies[0].Value)
+	assert.Equal(t, "dark", cookies[1].Value)
+	assert.Equal(t, "", cookies[2].Value)
+}
+
+// Test: Invalid cookie pairs
+func TestParseCookiesInvalid(t *testing.T) {
+	_, err := ParseCookies("novalue")
+	require.Error(t, err)
+
+	_, err = ParseCookies("bad name=1")
+	require.ErrorIs(t, err, ErrInvalidCookieName)
+
+	_, err = ParseCookies(`name=a"b`)
+	require.ErrorIs(t, err, ErrInvalidCookieValue)
+}
+
+// Test: Cookies from duplicate Cookie headers skip malformed pairs
+func TestHeadersCookies(t *testing.T) {
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("Cookie: a=1; b=2\r\n"))
+	require.NoError(t, err)
+	_, _, err = headers.Parse([]byte("Cookie: bad; c=3\r\n"))
+	require.NoError(t, err)
+
+	cookies := headers.Cookies()
+	require.Len(t, cookies, 3)
+	assert.Equal(t, "a", cookies[0].Name)
+	assert.Equal(t, "b", cookies[1].Name)
+	assert.Equal(t, "c", cookies[2].Name)
+}
+
+// Test: Set-Cookie serialization with all attributes
+func TestCookieString(t *testing.T) {
+	c := &Cookie{
+		Name:        "id",
+		Value:       "42",
+		Path:        "/",
+		Domain:      ".example.com",
+		Expires:     time.Date(2025, time.March, 1, 10, 0, 0, 0, time.UTC),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteStrict,
+		Partitioned: true,
+	}
+	require.NoError(t, c.Valid())
+	assert.Equal(t,
+		"id=42; Path=/; Domain=example.com; Expires=Sat, 01 Mar 2025 10:00:00 GMT; Max-Age=3600; Secure; HttpOnly; SameSite=Strict; Partitioned",
+		c.String())
+
+	deleted := &Cookie{Name: "id", MaxAge: -1}
+	assert.Equal(t, "id=; Max-Age=0", deleted.String())
+}
+
+// Test: Cookie validation
+func TestCookieValid(t *testing.T) {
+	assert.ErrorIs(t, (&Cookie{Name: ""}).Valid(), ErrInvalidCookieName)
+	assert.ErrorIs(t, (&Cookie{Name: "a", Value: "x y"}).Valid(), ErrInvalidCookieValue)
+	assert.ErrorIs(t, (&Cookie{Name: "a", Domain: "bad_domain"}).Valid(), ErrInvalidCookieDomain)
+	assert.ErrorIs(t, (&Cookie{Name: "a", SameSite: SameSiteNone}).Valid(), ErrCookieNotSecure)
+	assert.ErrorIs(t, (&Cookie{Name: "a", Partitioned: true}).Valid(), ErrCookieNotSecure)
+	assert.Error(t, (&Cookie{Name: "__Host-a", Secure: true}).Valid())
+	assert.NoError(t, (&Cookie{Name: "__Host-a", Secure: true, Path: "/"}).Valid())
+}
@@ -0,0 +1,55 @@
+package header
+
+import "strings"
+
+// ParseETags splits an If-Match or If-None-Match value into entity tags,
+// keeping the W/ prefix and quotes. A lone "*" is returned as is. Entity
+// tags may contain commas, so the value is scanned instead of split.
+func ParseETags(value string) []string {
+	value = strings.TrimSpace(value)
+	if value == "*" {
+		return []string{"*"}
+	}
+
+	etags := []string{}
+	for {
+		value = strings.TrimLeft(value, " \t,")
+		if value == "" {
+			return etags
+		}
+
+		start := 0
+		if strings.HasPrefix(value, "W/") {
+			start = 2
+		}
+
+		if len(value) <= start || value[start] != '"' {
+			// malformed, skip to the next element
+			_, rest, ok := strings.Cut(value, ",")
+			if !ok {
+				return etags
+			}
+			value = rest
+			continue
+		}
+
+		end := strings.IndexByte(value[start+1:], '"')
+		if end == -1 {
+			return etags
+		}
+		end += start + 2
+
+		etags = append(etags, value[:end])
+		value = value[end:]
+	}
+}
+
+// StrongMatch compares entity tags, both must be strong and equal.
+func StrongMatch(a, b string) bool {
+	return a != "" && !strings.HasPrefix(a, "W/") && !strings.HasPrefix(b, "W/") && a == b
+}
+
+// WeakMatch compares entity tags ignoring the W/ prefix.
+func WeakMatch(a, b string) bool {
+	return a != "" && strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
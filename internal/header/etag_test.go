@@ -0,0 +1,23 @@
+package header
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test: Entity tag lists, including commas inside tags
+func TestParseETags(t *testing.T) {
+	assert.Equal(t, []string{"*"}, ParseETags(" * "))
+	assert.Equal(t, []string{`"a"`, `W/"b"`, `"c,d"`}, ParseETags(`"a", W/"b" ,"c,d"`))
+	assert.Equal(t, []string{`"a"`}, ParseETags(`bogus, "a", "unterminated`))
+}
+
+// Test: Strong and weak comparison
+func TestETagMatch(t *testing.T) {
+	assert.True(t, StrongMatch(`"1"`, `"1"`))
+	assert.False(t, StrongMatch(`W/"1"`, `"1"`))
+	assert.False(t, StrongMatch(`"1"`, `"2"`))
+	assert.True(t, WeakMatch(`W/"1"`, `"1"`))
+	assert.False(t, WeakMatch(`W/"1"`, `W/"2"`))
+}
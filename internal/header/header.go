@@ -1,10 +1,10 @@
 package header
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"strings"
-	"unicode"
 )
 
 type Headers map[string]string
@@ -13,10 +13,18 @@ func NewHeaders() Headers {
 	return Headers{}
 }
 
+// Parse consumes one header line from data. It works on the bytes
+// directly, well known field names are interned so the common case only
+// allocates the value.
 func (h Headers) Parse(data []byte) (n int, done bool, err error) {
-	crlf := "\r\n"
-	dataStr := string(data)
-	crlfIndex := strings.Index(dataStr, crlf)
+	return h.ParseText(data, "")
+}
+
+// ParseText is Parse for a caller that also holds the leading bytes of
+// data as text. Values within text are sliced from it instead of copied,
+// so a whole header block costs one string.
+func (h Headers) ParseText(data []byte, text string) (n int, done bool, err error) {
+	crlfIndex := bytes.Index(data, crlf)
 
 	if crlfIndex == -1 {
 		return 0, false, nil
@@ -25,44 +33,94 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 	if crlfIndex == 0 {
 		return 2, true, nil
 	}
-	line := dataStr[:crlfIndex]
-	line = strings.TrimSpace(line)
+	line := bytes.TrimSpace(data[:crlfIndex])
 
-	colonIndex := strings.Index(line, ":")
+	colonIndex := bytes.IndexByte(line, ':')
 
 	if colonIndex == -1 || (colonIndex > 0 && line[colonIndex-1] == ' ') {
 		return 0, false, fmt.Errorf("invalid header format")
 	}
 
-	key := strings.TrimSpace(line[:colonIndex])
-	value := strings.TrimSpace(line[colonIndex+1:])
+	key := bytes.TrimSpace(line[:colonIndex])
+	value := bytes.TrimSpace(line[colonIndex+1:])
 
-	if key == "" || value == "" {
+	if len(key) == 0 || len(value) == 0 {
 		return 0, false, errors.New("invalid header key or value")
 	}
 
-	for _, r := range key {
-		if !(unicode.IsLetter(r) || unicode.IsDigit(r)) &&
-			!strings.ContainsRune("!#$%&'*+-.^_`|~", r) {
+	var lowerBuf [64]byte
+	lower := lowerBuf[:0]
+	for _, c := range key {
+		if !isTokenChar(c) {
 			return 0, false, errors.New("invalid character in header key")
 		}
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower = append(lower, c)
 	}
 
-	key = strings.ToLower(key)
+	// value shares data's array, its offset follows from the capacities
+	start := cap(data) - cap(value)
+	var valueStr string
+	if end := start + len(value); end <= len(text) {
+		valueStr = text[start:end]
+	} else {
+		valueStr = string(value)
+	}
 
-	if existingVal, ok := h[key]; !ok {
-		h[key] = value
+	if existingVal, ok := h[string(lower)]; !ok {
+		h[internKey(lower)] = valueStr
 	} else {
-		h[key] = fmt.Sprintf("%s, %s", existingVal, value)
+		h[string(lower)] = existingVal + ", " + valueStr
 	}
 
 	return crlfIndex + 2, false, nil
 }
 
+var crlf = []byte("\r\n")
+
+// commonKeys holds the field names most requests carry, looking one up
+// with a converted []byte key does not allocate.
+var commonKeys = map[string]string{}
+
+func init() {
+	for _, key := range []string{
+		"accept", "accept-encoding", "accept-language", "authorization",
+		"cache-control", "connection", "content-encoding", "content-length",
+		"content-type", "cookie", "forwarded", "host", "if-match",
+		"if-modified-since", "if-none-match", "if-range", "if-unmodified-since",
+		"origin", "range", "referer", "transfer-encoding", "upgrade",
+		"user-agent", "x-forwarded-for", "x-forwarded-host", "x-forwarded-proto",
+		"x-real-ip", "x-request-id",
+	} {
+		commonKeys[key] = key
+	}
+}
+
+func internKey(key []byte) string {
+	if s, ok := commonKeys[string(key)]; ok {
+		return s
+	}
+	return string(key)
+}
+
+func isTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	default:
+		return strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1
+	}
+}
+
 func (h Headers) Get(key string) string {
-	key = strings.ToLower(key)
+	if v, ok := h[key]; ok {
+		return v
+	}
+
 	for k, v := range h {
-		if strings.ToLower(k) == key {
+		if strings.EqualFold(k, key) {
 			return v
 		}
 	}
@@ -75,5 +133,9 @@ func (h Headers) Add(key, value string) {
 }
 
 func (h Headers) Remove(key string) {
-	delete(h, key)
+	for k := range h {
+		if strings.EqualFold(k, key) {
+			delete(h, k)
+		}
+	}
 }
@@ -107,3 +107,23 @@ func TestDuplicateHeaderAppendsValue(t *testing.T) {
 	assert.Equal(t, 26, n)
 	assert.False(t, done)
 }
+
+// Test: ParseText slices values from text, and copies those past its end
+func TestParseText(t *testing.T) {
+	data := []byte("Accept:  text/html \r\nHost: localhost\r\n")
+	text := string(data[:21])
+
+	headers := NewHeaders()
+	n, done, err := headers.ParseText(data, text)
+	require.NoError(t, err)
+	assert.Equal(t, 21, n)
+	assert.False(t, done)
+
+	n, _, err = headers.ParseText(data[n:], text[n:])
+	require.NoError(t, err)
+	assert.Equal(t, 17, n)
+
+	copy(data, "XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX")
+	assert.Equal(t, "text/html", headers["accept"])
+	assert.Equal(t, "localhost", headers["host"])
+}
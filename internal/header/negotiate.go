@@ -0,0 +1,235 @@
+package header
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// QualityValue is one element of a quality-valued list such as Accept or
+// Accept-Encoding.
+type QualityValue struct {
+	Value  string
+	Q      float64
+	Params map[string]string
+}
+
+// ParseQualityList parses a comma separated list of values with optional
+// parameters and q weights, sorted by descending q. Elements keep their
+// original order when q is equal. Elements with an invalid q are dropped.
+func ParseQualityList(value string) []QualityValue {
+	list := []QualityValue{}
+
+	for _, part := range strings.Split(value, ",") {
+		segments := strings.Split(part, ";")
+
+		v := strings.ToLower(strings.TrimSpace(segments[0]))
+		if v == "" {
+			continue
+		}
+
+		qv := QualityValue{Value: v, Q: 1}
+		valid := true
+
+		for _, param := range segments[1:] {
+			key, val, _ := strings.Cut(param, "=")
+			key = strings.ToLower(strings.TrimSpace(key))
+			val = strings.Trim(strings.TrimSpace(val), `"`)
+
+			if key == "q" {
+				q, err := strconv.ParseFloat(val, 64)
+				if err != nil || q < 0 || q > 1 {
+					valid = false
+					break
+				}
+				qv.Q = q
+				// parameters after q are accept-ext, not media type params
+				break
+			}
+
+			if key == "" {
+				continue
+			}
+
+			if qv.Params == nil {
+				qv.Params = map[string]string{}
+			}
+			qv.Params[key] = strings.ToLower(val)
+		}
+
+		if valid {
+			list = append(list, qv)
+		}
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Q > list[j].Q
+	})
+
+	return list
+}
+
+// NegotiateMediaType returns the offer the Accept value prefers, or "" if
+// none is acceptable. Each offer gets the q of the most specific matching
+// range (type/subtype with params, type/subtype, type/*, */*); ties go to
+// the earlier offer. An empty Accept accepts the first offer.
+func NegotiateMediaType(accept string, offers ...string) string {
+	if strings.TrimSpace(accept) == "" {
+		return first(offers)
+	}
+
+	ranges := ParseQualityList(accept)
+
+	return best(offers, func(offer string) (float64, bool) {
+		offerType, offerParams := splitMediaType(offer)
+		q, specificity := 0.0, -1
+
+		for _, r := range ranges {
+			s := mediaRangeSpecificity(r, offerType, offerParams)
+			if s > specificity {
+				q, specificity = r.Q, s
+			}
+		}
+
+		return q, specificity >= 0
+	})
+}
+
+// NegotiateLanguage returns the offered language tag the Accept-Language
+// value prefers, or "" if none is acceptable. Ranges match tags by prefix
+// (RFC 4647 basic filtering) and the longest matching range wins.
+func NegotiateLanguage(acceptLanguage string, offers ...string) string {
+	if strings.TrimSpace(acceptLanguage) == "" {
+		return first(offers)
+	}
+
+	ranges := ParseQualityList(acceptLanguage)
+
+	return best(offers, func(offer string) (float64, bool) {
+		tag := strings.ToLower(offer)
+		q, length := 0.0, -1
+
+		for _, r := range ranges {
+			matches := r.Value == "*" || r.Value == tag || strings.HasPrefix(tag, r.Value+"-")
+			if !matches {
+				continue
+			}
+
+			l := len(r.Value)
+			if r.Value == "*" {
+				l = 0
+			}
+			if l > length {
+				q, length = r.Q, l
+			}
+		}
+
+		return q, length >= 0
+	})
+}
+
+// NegotiateEncoding returns the offered content coding the Accept-Encoding
+// value prefers, or "" if none is acceptable. "identity" is acceptable
+// unless explicitly excluded, and is chosen for an empty header.
+func NegotiateEncoding(acceptEncoding string, offers ...string) string {
+	if strings.TrimSpace(acceptEncoding) == "" {
+		for _, offer := range offers {
+			if strings.EqualFold(offer, "identity") {
+				return offer
+			}
+		}
+		return first(offers)
+	}
+
+	return negotiateToken(ParseQualityList(acceptEncoding), offers, "identity")
+}
+
+// NegotiateCharset returns the offered charset the Accept-Charset value
+// prefers, or "" if none is acceptable.
+func NegotiateCharset(acceptCharset string, offers ...string) string {
+	if strings.TrimSpace(acceptCharset) == "" {
+		return first(offers)
+	}
+
+	return negotiateToken(ParseQualityList(acceptCharset), offers, "")
+}
+
+// negotiateToken matches exact tokens with "*" as fallback. implicit is a
+// token acceptable with q=1 unless listed or excluded through "*".
+func negotiateToken(list []QualityValue, offers []string, implicit string) string {
+	return best(offers, func(offer string) (float64, bool) {
+		offer = strings.ToLower(offer)
+		wildcard, hasWildcard := 0.0, false
+
+		for _, v := range list {
+			if v.Value == offer {
+				return v.Q, true
+			}
+			if v.Value == "*" && !hasWildcard {
+				wildcard, hasWildcard = v.Q, true
+			}
+		}
+
+		if hasWildcard {
+			return wildcard, true
+		}
+
+		if implicit != "" && offer == implicit {
+			return 1, true
+		}
+
+		return 0, false
+	})
+}
+
+// best returns the offer with the highest q > 0, the earliest one on ties.
+func best(offers []string, quality func(offer string) (float64, bool)) string {
+	chosen, chosenQ := "", 0.0
+
+	for _, offer := range offers {
+		q, ok := quality(offer)
+		if ok && q > chosenQ {
+			chosen, chosenQ = offer, q
+		}
+	}
+
+	return chosen
+}
+
+func first(offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	return offers[0]
+}
+
+func splitMediaType(mediaType string) (string, map[string]string) {
+	parsed := ParseQualityList(mediaType)
+	if len(parsed) == 0 {
+		return "", nil
+	}
+	return parsed[0].Value, parsed[0].Params
+}
+
+// mediaRangeSpecificity returns how specifically r matches the offer, or
+// -1 if it doesn't match at all.
+func mediaRangeSpecificity(r QualityValue, offerType string, offerParams map[string]string) int {
+	rangeType, rangeSub, _ := strings.Cut(r.Value, "/")
+	typ, sub, _ := strings.Cut(offerType, "/")
+
+	switch {
+	case rangeType == "*" && rangeSub == "*":
+		return 0
+	case rangeType == typ && rangeSub == "*":
+		return 1
+	case rangeType == typ && rangeSub == sub:
+		for key, val := range r.Params {
+			if offerParams[key] != val {
+				return -1
+			}
+		}
+		return 2 + len(r.Params)
+	default:
+		return -1
+	}
+}
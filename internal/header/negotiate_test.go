@@ -0,0 +1,61 @@
+package header
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test: Quality list parsing and ordering
+func TestParseQualityList(t *testing.T) {
+	list := ParseQualityList("text/html;level=1, application/json;q=0.5, */*;q=0.1, text/plain;q=abc")
+	require.Len(t, list, 3)
+	assert.Equal(t, "text/html", list[0].Value)
+	assert.Equal(t, "1", list[0].Params["level"])
+	assert.Equal(t, 1.0, list[0].Q)
+	assert.Equal(t, "application/json", list[1].Value)
+	assert.Equal(t, 0.5, list[1].Q)
+	assert.Equal(t, "*/*", list[2].Value)
+}
+
+// Test: Media type negotiation with wildcards and specificity
+func TestNegotiateMediaType(t *testing.T) {
+	assert.Equal(t, "text/html", NegotiateMediaType("", "text/html", "application/json"))
+	assert.Equal(t, "application/json", NegotiateMediaType("application/json", "text/html", "application/json"))
+	assert.Equal(t, "text/html", NegotiateMediaType("*/*", "text/html", "application/json"))
+	assert.Equal(t, "application/json", NegotiateMediaType("text/*;q=0.3, application/json;q=0.8", "text/html", "application/json"))
+
+	// the more specific text/html;q=0 wins over text/*
+	assert.Equal(t, "text/plain", NegotiateMediaType("text/*, text/html;q=0", "text/html", "text/plain"))
+
+	// params must match
+	assert.Equal(t, "text/html;level=1", NegotiateMediaType("text/html;level=1, text/html;q=0.1", "text/html", "text/html;level=1"))
+
+	assert.Equal(t, "", NegotiateMediaType("image/png", "text/html", "application/json"))
+}
+
+// Test: Language negotiation with prefix matching
+func TestNegotiateLanguage(t *testing.T) {
+	assert.Equal(t, "en-US", NegotiateLanguage("fr;q=0.5, en", "fr", "en-US"))
+	assert.Equal(t, "fr", NegotiateLanguage("en-GB, fr;q=0.8", "en-US", "fr"))
+	assert.Equal(t, "de", NegotiateLanguage("*;q=0.5, en;q=0", "en", "de"))
+	assert.Equal(t, "", NegotiateLanguage("ja", "en", "de"))
+}
+
+// Test: Encoding negotiation with implicit identity
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "identity", NegotiateEncoding("", "gzip", "identity"))
+	assert.Equal(t, "gzip", NegotiateEncoding("gzip, deflate", "gzip", "deflate", "identity"))
+	assert.Equal(t, "deflate", NegotiateEncoding("gzip;q=0.5, deflate", "gzip", "deflate", "identity"))
+	assert.Equal(t, "identity", NegotiateEncoding("br", "gzip", "identity"))
+	assert.Equal(t, "", NegotiateEncoding("br, identity;q=0", "gzip", "identity"))
+	assert.Equal(t, "", NegotiateEncoding("*;q=0", "gzip", "identity"))
+}
+
+// Test: Charset negotiation
+func TestNegotiateCharset(t *testing.T) {
+	assert.Equal(t, "utf-8", NegotiateCharset("iso-8859-1;q=0.5, utf-8", "iso-8859-1", "utf-8"))
+	assert.Equal(t, "iso-8859-1", NegotiateCharset("*", "iso-8859-1", "utf-8"))
+	assert.Equal(t, "", NegotiateCharset("utf-16", "utf-8"))
+}
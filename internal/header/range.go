@@ -0,0 +1,108 @@
+package header
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidRange       = errors.New("invalid range")
+	ErrUnsatisfiableRange = errors.New("unsatisfiable range")
+)
+
+// maxRanges bounds the ranges accepted in one request so clients can't
+// ask for thousands of tiny parts
+const maxRanges = 100
+
+// ByteRange is a resolved byte range of a representation of known size.
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// ContentRange formats the range for a Content-Range header.
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a Range header value against a representation of the
+// given size. It returns ErrInvalidRange for values that should be
+// ignored and ErrUnsatisfiableRange when no range overlaps the content.
+func ParseRange(value string, size int64) ([]ByteRange, error) {
+	unit, spec, ok := strings.Cut(strings.TrimSpace(value), "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, ErrInvalidRange
+	}
+
+	specs := strings.Split(spec, ",")
+	if len(specs) > maxRanges {
+		return nil, ErrInvalidRange
+	}
+
+	ranges := []ByteRange{}
+	parsed := 0
+	for _, s := range specs {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		parsed++
+
+		first, last, ok := strings.Cut(s, "-")
+		if !ok {
+			return nil, ErrInvalidRange
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var r ByteRange
+		if first == "" {
+			// suffix range: the last N bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, ErrInvalidRange
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = ByteRange{Start: size - n, Length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, ErrInvalidRange
+			}
+
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, ErrInvalidRange
+				}
+			}
+
+			if start >= size {
+				continue
+			}
+			if end >= size {
+				end = size - 1
+			}
+			r = ByteRange{Start: start, Length: end - start + 1}
+		}
+
+		ranges = append(ranges, r)
+	}
+
+	if parsed == 0 {
+		return nil, ErrInvalidRange
+	}
+
+	if len(ranges) == 0 {
+		return nil, ErrUnsatisfiableRange
+	}
+
+	return ranges, nil
+}
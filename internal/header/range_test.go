@@ -0,0 +1,44 @@
+package header
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test: Valid byte ranges
+func TestParseRange(t *testing.T) {
+	ranges, err := ParseRange("bytes=0-99", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 0, Length: 100}}, ranges)
+
+	ranges, err = ParseRange("bytes=900-", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 900, Length: 100}}, ranges)
+
+	ranges, err = ParseRange("bytes=-50", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 950, Length: 50}}, ranges)
+
+	// end clamped to size, unsatisfiable parts dropped
+	ranges, err = ParseRange("bytes=0-0, 990-2000, 5000-6000", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, []ByteRange{{Start: 0, Length: 1}, {Start: 990, Length: 10}}, ranges)
+
+	assert.Equal(t, "bytes 990-999/1000", ranges[1].ContentRange(1000))
+}
+
+// Test: Invalid and unsatisfiable ranges
+func TestParseRangeErrors(t *testing.T) {
+	for _, value := range []string{"items=0-1", "bytes=", "bytes=5-1", "bytes=a-b", "bytes=1"} {
+		_, err := ParseRange(value, 1000)
+		assert.ErrorIs(t, err, ErrInvalidRange, value)
+	}
+
+	_, err := ParseRange("bytes=1000-", 1000)
+	assert.ErrorIs(t, err, ErrUnsatisfiableRange)
+
+	_, err = ParseRange("bytes=-0", 1000)
+	assert.ErrorIs(t, err, ErrUnsatisfiableRange)
+}
@@ -0,0 +1,127 @@
+package mtls
+
+import (
+	"io"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/harry713j/http-server/internal/server"
+)
+
+// Rule is the client certificate requirement for the paths under Prefix.
+// The allow lists are alternatives, a client matching any entry of any
+// list passes. Empty lists accept every verified certificate.
+type Rule struct {
+	Prefix string
+	// Require rejects clients without a verified certificate. Rules that
+	// only set allow lists imply it.
+	Require bool
+	// SPIFFEIDs are allowed SPIFFE IDs. An entry ending in "/" allows
+	// every ID below it, "spiffe://example.org/" a whole trust domain.
+	SPIFFEIDs   []string
+	CommonNames []string
+	DNSNames    []string
+}
+
+type Options struct {
+	// Rules are matched by the longest Prefix. Paths no rule matches are
+	// open to everyone.
+	Rules []Rule
+}
+
+// Policy enforces client certificate rules per route. The certificates
+// themselves are verified during the handshake, see
+// server.TLSConfig.ClientCAFiles.
+type Policy struct {
+	rules []Rule
+}
+
+func New(opts Options) *Policy {
+	rules := slices.Clone(opts.Rules)
+	slices.SortStableFunc(rules, func(a, b Rule) int {
+		return len(b.Prefix) - len(a.Prefix)
+	})
+
+	return &Policy{rules: rules}
+}
+
+// Middleware answers requests that break the matching rule with 403.
+func (p *Policy) Middleware(next server.Handler) server.Handler {
+	return func(w io.Writer, r *request.Request) *server.HandlerError {
+		urlPath, err := cleanPath(r.RequestLine.RequestTarget)
+		if err != nil {
+			return &server.HandlerError{StatusCode: response.StatusBadRequest, Message: "invalid path"}
+		}
+
+		rule, ok := p.match(urlPath)
+		if !ok {
+			return next(w, r)
+		}
+
+		id := r.ClientIdentity()
+		if id == nil {
+			if rule.Require || rule.hasAllowList() {
+				return &server.HandlerError{StatusCode: response.StatusForbidden, Message: "A client certificate is required"}
+			}
+			return next(w, r)
+		}
+
+		if rule.hasAllowList() && !rule.allows(id) {
+			return &server.HandlerError{StatusCode: response.StatusForbidden, Message: "Client certificate is not allowed here"}
+		}
+
+		return next(w, r)
+	}
+}
+
+// cleanPath decodes and cleans the path of target the way the file server
+// resolves it, so "..", escapes and doubled slashes can't dodge a rule.
+func cleanPath(target string) (string, error) {
+	urlPath, _, _ := strings.Cut(target, "?")
+	urlPath, err := url.PathUnescape(urlPath)
+	if err != nil {
+		return "", err
+	}
+	return path.Clean("/" + urlPath), nil
+}
+
+// match finds the rule for a cleaned path. Prefixes match whole segments,
+// "/admin" covers "/admin/x" but not "/administrator".
+func (p *Policy) match(urlPath string) (Rule, bool) {
+	for _, rule := range p.rules {
+		prefix := strings.TrimSuffix(rule.Prefix, "/")
+		if prefix == "" || urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/") {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+func (r Rule) hasAllowList() bool {
+	return len(r.SPIFFEIDs) > 0 || len(r.CommonNames) > 0 || len(r.DNSNames) > 0
+}
+
+func (r Rule) allows(id *request.ClientIdentity) bool {
+	if id.SPIFFEID != "" {
+		for _, allowed := range r.SPIFFEIDs {
+			if id.SPIFFEID == allowed || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(id.SPIFFEID, allowed)) {
+				return true
+			}
+		}
+	}
+
+	if id.Subject.CommonName != "" && slices.Contains(r.CommonNames, id.Subject.CommonName) {
+		return true
+	}
+
+	for _, name := range id.DNSNames {
+		if slices.ContainsFunc(r.DNSNames, func(allowed string) bool { return strings.EqualFold(allowed, name) }) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net/url"
+	"testing"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/harry713j/http-server/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func ok(w io.Writer, r *request.Request) *server.HandlerError {
+	return nil
+}
+
+// newRequest builds a request whose client presented cert, nil for none.
+func newRequest(target string, cert *x509.Certificate) *request.Request {
+	r := &request.Request{Headers: header.NewHeaders()}
+	r.RequestLine.Method = "GET"
+	r.RequestLine.RequestTarget = target
+	if cert != nil {
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	return r
+}
+
+func clientCert(commonName string, uris ...string) *x509.Certificate {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	for _, u := range uris {
+		parsed, _ := url.Parse(u)
+		cert.URIs = append(cert.URIs, parsed)
+	}
+	return cert
+}
+
+func status(hErr *server.HandlerError) response.StatusCode {
+	if hErr == nil {
+		return response.StatusOk
+	}
+	return hErr.StatusCode
+}
+
+func TestPolicy(t *testing.T) {
+	policy := New(Options{Rules: []Rule{
+		{Prefix: "/internal/", Require: true},
+		{Prefix: "/internal/billing/", SPIFFEIDs: []string{"spiffe://example.org/billing"}},
+		{Prefix: "/internal/ops/", SPIFFEIDs: []string{"spiffe://example.org/ops/"}, CommonNames: []string{"oncall"}},
+	}})
+	handler := policy.Middleware(ok)
+
+	billing := clientCert("billing", "spiffe://example.org/billing")
+	deploy := clientCert("deploy", "spiffe://example.org/ops/deploy")
+	oncall := clientCert("oncall")
+
+	// Test: paths without a rule are open
+	assert.Equal(t, response.StatusOk, status(handler(nil, newRequest("/", nil))))
+
+	// Test: Require rejects clients without a certificate
+	assert.Equal(t, response.StatusForbidden, status(handler(nil, newRequest("/internal/status", nil))))
+	assert.Equal(t, response.StatusOk, status(handler(nil, newRequest("/internal/status", oncall))))
+
+	// Test: the longest prefix wins and its allow list applies
+	assert.Equal(t, response.StatusOk, status(handler(nil, newRequest("/internal/billing/invoices?page=2", billing))))
+	assert.Equal(t, response.StatusForbidden, status(handler(nil, newRequest("/internal/billing/invoices", deploy))))
+	assert.Equal(t, response.StatusForbidden, status(handler(nil, newRequest("/internal/billing/invoices", nil))))
+
+	// Test: SPIFFE ID prefixes and common names are alternatives
+	assert.Equal(t, response.StatusOk, status(handler(nil, newRequest("/internal/ops/restart", deploy))))
+	assert.Equal(t, response.StatusOk, status(handler(nil, newRequest("/internal/ops/restart", oncall))))
+	assert.Equal(t, response.StatusForbidden, status(handler(nil, newRequest("/internal/ops/restart", billing))))
+
+	// Test: dot segments, escapes and doubled slashes don't dodge a rule
+	assert.Equal(t, response.StatusForbidden, status(handler(nil, newRequest("/public/../internal/status", nil))))
+	assert.Equal(t, response.StatusForbidden, status(handler(nil, newRequest("/%69nternal/status", nil))))
+	assert.Equal(t, response.StatusForbidden, status(handler(nil, newRequest("//internal/status", nil))))
+	assert.Equal(t, response.StatusForbidden, status(handler(nil, newRequest("/internal", nil))))
+
+	// Test: paths that don't decode are rejected
+	assert.Equal(t, response.StatusBadRequest, status(handler(nil, newRequest("/internal%zz", nil))))
+}
+
+// Test: prefixes match whole path segments
+func TestPolicySegments(t *testing.T) {
+	handler := New(Options{Rules: []Rule{{Prefix: "/admin", Require: true}}}).Middleware(ok)
+
+	assert.Equal(t, response.StatusForbidden, status(handler(nil, newRequest("/admin", nil))))
+	assert.Equal(t, response.StatusForbidden, status(handler(nil, newRequest("/admin/users", nil))))
+	assert.Equal(t, response.StatusOk, status(handler(nil, newRequest("/administrator", nil))))
+}
+
+func TestClientIdentity(t *testing.T) {
+	// Test: no TLS or no verified chain means no identity
+	assert.Nil(t, newRequest("/", nil).ClientIdentity())
+	r := newRequest("/", nil)
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{clientCert("unverified")}}
+	assert.Nil(t, r.ClientIdentity())
+
+	// Test: the SPIFFE ID is taken from the single spiffe URI SAN
+	id := newRequest("/", clientCert("svc", "spiffe://example.org/svc", "https://svc.example.org")).ClientIdentity()
+	assert.Equal(t, "svc", id.Subject.CommonName)
+	assert.Equal(t, "spiffe://example.org/svc", id.SPIFFEID)
+	assert.Len(t, id.URIs, 2)
+
+	// Test: several spiffe URIs are ambiguous and give no SPIFFE ID
+	id = newRequest("/", clientCert("svc", "spiffe://example.org/a", "spiffe://example.org/b")).ClientIdentity()
+	assert.Empty(t, id.SPIFFEID)
+}
@@ -0,0 +1,19 @@
+// Package netutil holds helpers for types that wrap a net.Conn.
+package netutil
+
+import (
+	"io"
+	"net"
+)
+
+// ReadFrom implements io.ReaderFrom for types wrapping conn. Embedding
+// conn hides its own ReadFrom, and with it the sendfile(2) and splice(2)
+// paths of *net.TCPConn, so wrappers hand r to it explicitly. Connections
+// without a ReadFrom get a plain copy.
+func ReadFrom(conn net.Conn, r io.Reader) (int64, error) {
+	if rf, ok := conn.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	// hide ReadFrom on the wrapper so io.Copy doesn't call back into it
+	return io.Copy(struct{ io.Writer }{conn}, r)
+}
@@ -0,0 +1,142 @@
+package proxyproto
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/harry713j/http-server/internal/netutil"
+)
+
+// Options configures NewListener.
+type Options struct {
+	// Trusted are the sources that must send a header, usually the load
+	// balancers. Connections from other sources are served as they are and
+	// a header they send is not parsed, so clients can't spoof an address.
+	// Empty trusts every source. Unix socket peers are always trusted.
+	Trusted []netip.Prefix
+	// HeaderTimeout bounds reading the header, 5 seconds by default.
+	HeaderTimeout time.Duration
+}
+
+// Listener reads a PROXY header from the start of every accepted
+// connection from a trusted source.
+type Listener struct {
+	net.Listener
+	opts Options
+}
+
+func NewListener(l net.Listener, opts Options) *Listener {
+	if opts.HeaderTimeout == 0 {
+		opts.HeaderTimeout = 5 * time.Second
+	}
+	return &Listener{Listener: l, opts: opts}
+}
+
+// Accept does not wait for the header, it is read by the first Read or
+// ReadHeader on the connection.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{Conn: conn, trusted: l.trusts(conn.RemoteAddr()), timeout: l.opts.HeaderTimeout}, nil
+}
+
+func (l *Listener) trusts(addr net.Addr) bool {
+	if len(l.opts.Trusted) == 0 {
+		return true
+	}
+
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+
+	ip := tcpAddr.AddrPort().Addr().Unmap()
+	for _, prefix := range l.opts.Trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is a connection accepted by a Listener. Once its header is read,
+// RemoteAddr and LocalAddr report the addresses from the header.
+type Conn struct {
+	net.Conn
+	trusted bool
+	timeout time.Duration
+
+	once   sync.Once
+	br     *bufio.Reader // holds what was read past the header
+	header atomic.Pointer[Header]
+	err    error
+}
+
+// ReadHeader reads the header if that hasn't happened yet. It returns
+// nil without an error for connections from untrusted sources.
+func (c *Conn) ReadHeader() (*Header, error) {
+	c.once.Do(func() {
+		if !c.trusted {
+			return
+		}
+
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		c.br = bufio.NewReaderSize(c.Conn, 256)
+		h, err := ReadHeader(c.br)
+		if err != nil {
+			c.err = err
+			return
+		}
+		c.header.Store(h)
+	})
+
+	return c.header.Load(), c.err
+}
+
+// Header returns the header read from the connection, nil if there is
+// none (yet).
+func (c *Conn) Header() *Header {
+	return c.header.Load()
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	if _, err := c.ReadHeader(); err != nil {
+		return 0, err
+	}
+
+	if c.br != nil {
+		if c.br.Buffered() > 0 {
+			return c.br.Read(p)
+		}
+		c.br = nil
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	if h := c.header.Load(); h != nil && !h.Local {
+		return h.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	if h := c.header.Load(); h != nil && !h.Local {
+		return h.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *Conn) ReadFrom(r io.Reader) (int64, error) {
+	return netutil.ReadFrom(c.Conn, r)
+}
@@ -0,0 +1,298 @@
+// Package proxyproto reads the HAProxy PROXY protocol header a load
+// balancer puts in front of a connection to pass on the client's address.
+// Both the v1 text and the v2 binary format are supported.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNoHeader      = errors.New("connection did not start with a PROXY header")
+	ErrInvalidHeader = errors.New("invalid PROXY header")
+)
+
+// Well known v2 TLV types.
+const (
+	TypeALPN      byte = 0x01
+	TypeAuthority byte = 0x02 // the SNI host name the client sent
+	TypeCRC32C    byte = 0x03
+	TypeNoop      byte = 0x04
+	TypeUniqueID  byte = 0x05
+	TypeSSL       byte = 0x20
+	TypeNetNS     byte = 0x30
+)
+
+// Header is a parsed PROXY header.
+type Header struct {
+	Version int // 1 or 2
+	// Local is set for v2 LOCAL and v1 UNKNOWN headers, which the balancer
+	// sends for its own connections, health checks for instance. Source and
+	// Destination are nil then.
+	Local bool
+	// Source is the client's address, Destination the address it
+	// connected to on the balancer.
+	Source      net.Addr
+	Destination net.Addr
+	TLVs        []TLV // v2 only
+}
+
+// TLV is a v2 type-length-value extension.
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// TLV returns the value of the first extension of type typ.
+func (h *Header) TLV(typ byte) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == typ {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// v1MaxLength is the longest v1 line the spec allows, CRLF included.
+const v1MaxLength = 107
+
+// ReadHeader reads a v1 or v2 header from r, leaving r at the first byte
+// after it.
+func ReadHeader(r *bufio.Reader) (*Header, error) {
+	sig, err := r.Peek(len(v2Signature))
+
+	switch {
+	case bytes.Equal(sig, v2Signature):
+		return readV2(r)
+	case bytes.HasPrefix(sig, v1Prefix):
+		return readV1(r)
+	case err != nil:
+		return nil, err
+	default:
+		return nil, ErrNoHeader
+	}
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+	}
+
+	line, ok := bytes.CutSuffix(line, []byte("\r\n"))
+	if !ok {
+		return nil, fmt.Errorf("%w: v1 line not terminated by CRLF", ErrInvalidHeader)
+	}
+
+	fields := strings.Split(string(line), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return &Header{Version: 1, Local: true}, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("%w: v1 line has %d fields", ErrInvalidHeader, len(fields))
+	}
+
+	src, err := v1Addr(fields[1], fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := v1Addr(fields[1], fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Header{Version: 1, Source: src, Destination: dst}, nil
+}
+
+func v1Addr(proto, ip, port string) (net.Addr, error) {
+	addr := net.ParseIP(ip)
+	switch {
+	case proto != "TCP4" && proto != "TCP6":
+		return nil, fmt.Errorf("%w: v1 protocol %q", ErrInvalidHeader, proto)
+	case addr == nil, (proto == "TCP4") != (addr.To4() != nil):
+		return nil, fmt.Errorf("%w: %s address %q", ErrInvalidHeader, proto, ip)
+	}
+
+	// no leading zeros or signs
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || strconv.FormatUint(p, 10) != port {
+		return nil, fmt.Errorf("%w: port %q", ErrInvalidHeader, port)
+	}
+
+	return &net.TCPAddr{IP: addr, Port: int(p)}, nil
+}
+
+// address block sizes of the v2 families
+const (
+	v2IPv4Length = 12
+	v2IPv6Length = 36
+	v2UnixLength = 216
+)
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	raw := make([]byte, 16)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, err
+	}
+
+	if raw[12]>>4 != 2 {
+		return nil, fmt.Errorf("%w: v2 version %d", ErrInvalidHeader, raw[12]>>4)
+	}
+
+	command := raw[12] & 0x0f
+	if command > 1 {
+		return nil, fmt.Errorf("%w: v2 command %d", ErrInvalidHeader, command)
+	}
+
+	length := int(binary.BigEndian.Uint16(raw[14:16]))
+	raw = append(raw, make([]byte, length)...)
+	if _, err := io.ReadFull(r, raw[16:]); err != nil {
+		return nil, err
+	}
+
+	h := &Header{Version: 2, Local: command == 0}
+
+	family, transport := raw[13]>>4, raw[13]&0x0f
+	var addrLength int
+	switch family {
+	case 0x0: // AF_UNSPEC
+		h.Local = true
+	case 0x1: // AF_INET
+		addrLength = v2IPv4Length
+	case 0x2: // AF_INET6
+		addrLength = v2IPv6Length
+	case 0x3: // AF_UNIX
+		addrLength = v2UnixLength
+	default:
+		return nil, fmt.Errorf("%w: v2 address family %d", ErrInvalidHeader, family)
+	}
+	if transport > 2 {
+		return nil, fmt.Errorf("%w: v2 transport %d", ErrInvalidHeader, transport)
+	}
+	if length < addrLength {
+		return nil, fmt.Errorf("%w: v2 address block too short", ErrInvalidHeader)
+	}
+
+	// a LOCAL header may carry addresses, they are to be ignored
+	if !h.Local {
+		h.Source, h.Destination = v2Addrs(family, transport, raw[16:16+addrLength])
+	}
+
+	tlvStart := 16 + addrLength
+	tlvs, crcAt, err := parseTLVs(raw[tlvStart:])
+	if err != nil {
+		return nil, err
+	}
+	h.TLVs = tlvs
+
+	if crcAt != -1 {
+		if err := checkCRC32C(raw, tlvStart+crcAt); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+func v2Addrs(family, transport byte, b []byte) (src, dst net.Addr) {
+	switch family {
+	case 0x1, 0x2:
+		ipLength := 4
+		if family == 0x2 {
+			ipLength = 16
+		}
+		srcIP := net.IP(bytes.Clone(b[:ipLength]))
+		dstIP := net.IP(bytes.Clone(b[ipLength : 2*ipLength]))
+		srcPort := int(binary.BigEndian.Uint16(b[2*ipLength:]))
+		dstPort := int(binary.BigEndian.Uint16(b[2*ipLength+2:]))
+
+		if transport == 0x2 {
+			return &net.UDPAddr{IP: srcIP, Port: srcPort}, &net.UDPAddr{IP: dstIP, Port: dstPort}
+		}
+		return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}
+	default:
+		network := "unix"
+		if transport == 0x2 {
+			network = "unixgram"
+		}
+		return &net.UnixAddr{Name: unixPath(b[:108]), Net: network}, &net.UnixAddr{Name: unixPath(b[108:]), Net: network}
+	}
+}
+
+func unixPath(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i != -1 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// parseTLVs also returns the offset of the CRC32C value in b, -1 if
+// there is none.
+func parseTLVs(b []byte) ([]TLV, int, error) {
+	var tlvs []TLV
+	crcAt := -1
+
+	for offset := 0; offset < len(b); {
+		if len(b)-offset < 3 {
+			return nil, 0, fmt.Errorf("%w: truncated TLV", ErrInvalidHeader)
+		}
+
+		typ := b[offset]
+		length := int(binary.BigEndian.Uint16(b[offset+1:]))
+		start := offset + 3
+		if len(b)-start < length {
+			return nil, 0, fmt.Errorf("%w: TLV 0x%02x longer than the header", ErrInvalidHeader, typ)
+		}
+
+		switch typ {
+		case TypeNoop:
+		case TypeCRC32C:
+			if length != 4 {
+				return nil, 0, fmt.Errorf("%w: CRC32C TLV of %d bytes", ErrInvalidHeader, length)
+			}
+			crcAt = start
+			fallthrough
+		default:
+			tlvs = append(tlvs, TLV{Type: typ, Value: b[start : start+length]})
+		}
+		offset = start + length
+	}
+	return tlvs, crcAt, nil
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// checkCRC32C verifies the checksum at crcAt, which covers the whole
+// header with the checksum itself zeroed.
+func checkCRC32C(raw []byte, crcAt int) error {
+	want := binary.BigEndian.Uint32(raw[crcAt:])
+
+	zeroed := bytes.Clone(raw)
+	clear(zeroed[crcAt : crcAt+4])
+
+	if crc32.Checksum(zeroed, castagnoli) != want {
+		return fmt.Errorf("%w: CRC32C mismatch", ErrInvalidHeader)
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package proxyproto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func read(t *testing.T, raw string) (*Header, string, error) {
+	t.Helper()
+
+	br := bufio.NewReader(strings.NewReader(raw))
+	h, err := ReadHeader(br)
+	rest, _ := io.ReadAll(br)
+	return h, string(rest), err
+}
+
+// v2 builds a v2 header for a TCP over IPv4 connection.
+func v2(command byte, tlvs ...TLV) []byte {
+	b := append([]byte{}, v2Signature...)
+	b = append(b, 0x20|command, 0x11, 0, 0)
+	b = append(b, 192, 0, 2, 1, 198, 51, 100, 7)
+	b = binary.BigEndian.AppendUint16(b, 51234)
+	b = binary.BigEndian.AppendUint16(b, 443)
+	for _, tlv := range tlvs {
+		b = append(b, tlv.Type)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(tlv.Value)))
+		b = append(b, tlv.Value...)
+	}
+	binary.BigEndian.PutUint16(b[14:], uint16(len(b)-16))
+	return b
+}
+
+func TestReadHeaderV1(t *testing.T) {
+	// Test: TCP4 addresses, the bytes after the header are left unread
+	h, rest, err := read(t, "PROXY TCP4 192.0.2.1 198.51.100.7 51234 443\r\nGET / HTTP/1.1\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, 1, h.Version)
+	assert.False(t, h.Local)
+	assert.Equal(t, "192.0.2.1:51234", h.Source.String())
+	assert.Equal(t, "198.51.100.7:443", h.Destination.String())
+	assert.Equal(t, "GET / HTTP/1.1\r\n", rest)
+
+	// Test: TCP6 addresses
+	h, _, err = read(t, "PROXY TCP6 2001:db8::1 2001:db8::2 51234 443\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:51234", h.Source.String())
+
+	// Test: UNKNOWN is a local connection
+	h, _, err = read(t, "PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n")
+	require.NoError(t, err)
+	assert.True(t, h.Local)
+	assert.Nil(t, h.Source)
+
+	for _, raw := range []string{
+		"PROXY TCP4 192.0.2.1 198.51.100.7 51234\r\n",
+		"PROXY TCP4 2001:db8::1 198.51.100.7 51234 443\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.7 051234 443\r\n",
+		"PROXY UDP4 192.0.2.1 198.51.100.7 51234 443\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.7 51234 443\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.7 51234 443" + strings.Repeat(" ", 100) + "\r\n",
+	} {
+		// Test: malformed v1 lines
+		_, _, err := read(t, raw)
+		assert.ErrorIs(t, err, ErrInvalidHeader, raw)
+	}
+}
+
+func TestReadHeaderV2(t *testing.T) {
+	// Test: PROXY command with TLVs, NOOP padding is dropped
+	raw := v2(1, TLV{Type: TypeAuthority, Value: []byte("example.com")}, TLV{Type: TypeNoop, Value: []byte{0, 0}})
+	h, rest, err := read(t, string(raw)+"GET")
+	require.NoError(t, err)
+	assert.Equal(t, 2, h.Version)
+	assert.Equal(t, "192.0.2.1:51234", h.Source.String())
+	assert.Equal(t, "198.51.100.7:443", h.Destination.String())
+	assert.Len(t, h.TLVs, 1)
+	authority, ok := h.TLV(TypeAuthority)
+	assert.True(t, ok)
+	assert.Equal(t, "example.com", string(authority))
+	assert.Equal(t, "GET", rest)
+
+	// Test: LOCAL command ignores the addresses
+	h, _, err = read(t, string(v2(0)))
+	require.NoError(t, err)
+	assert.True(t, h.Local)
+	assert.Nil(t, h.Source)
+
+	// Test: unix socket addresses
+	unix := append([]byte{}, v2Signature...)
+	unix = append(unix, 0x21, 0x31, 0, 216)
+	src, dst := make([]byte, 108), make([]byte, 108)
+	copy(src, "/run/client.sock")
+	copy(dst, "/run/app.sock")
+	unix = append(append(unix, src...), dst...)
+	h, _, err = read(t, string(unix))
+	require.NoError(t, err)
+	assert.Equal(t, &net.UnixAddr{Name: "/run/client.sock", Net: "unix"}, h.Source)
+	assert.Equal(t, &net.UnixAddr{Name: "/run/app.sock", Net: "unix"}, h.Destination)
+
+	// Test: a valid CRC32C checksum is accepted, a wrong one rejected
+	raw = v2(1, TLV{Type: TypeCRC32C, Value: make([]byte, 4)})
+	sum := crc32.Checksum(raw, crc32.MakeTable(crc32.Castagnoli))
+	binary.BigEndian.PutUint32(raw[len(raw)-4:], sum)
+	_, _, err = read(t, string(raw))
+	require.NoError(t, err)
+
+	raw[len(raw)-1]++
+	_, _, err = read(t, string(raw))
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+
+	// Test: a TLV running past the header is rejected
+	raw = v2(1, TLV{Type: TypeUniqueID, Value: []byte("id")})
+	binary.BigEndian.PutUint16(raw[len(raw)-4:], 10)
+	_, _, err = read(t, string(raw))
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+
+	// Test: an unknown version is rejected
+	raw = v2(1)
+	raw[12] = 0x31
+	_, _, err = read(t, string(raw))
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+}
+
+// Test: a connection without a header
+func TestReadHeaderMissing(t *testing.T) {
+	_, _, err := read(t, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.ErrorIs(t, err, ErrNoHeader)
+}
+
+func TestListener(t *testing.T) {
+	accept := func(t *testing.T, opts Options, send string) *Conn {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		pl := NewListener(l, opts)
+		defer pl.Close()
+
+		client, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { client.Close() })
+		_, err = io.WriteString(client, send)
+		require.NoError(t, err)
+
+		conn, err := pl.Accept()
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return conn.(*Conn)
+	}
+
+	// Test: a trusted source's header sets the addresses, reads continue
+	// after it
+	conn := accept(t, Options{}, "PROXY TCP4 192.0.2.1 198.51.100.7 51234 443\r\nhello")
+	buf := make([]byte, 5)
+	_, err := io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+	assert.Equal(t, "192.0.2.1:51234", conn.RemoteAddr().String())
+	assert.Equal(t, "198.51.100.7:443", conn.LocalAddr().String())
+	assert.NotNil(t, conn.Header())
+
+	// Test: an untrusted source's header is left for the application
+	untrusted := Options{Trusted: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	conn = accept(t, untrusted, "PROXY TCP4 192.0.2.1 198.51.100.7 51234 443\r\n")
+	h, err := conn.ReadHeader()
+	require.NoError(t, err)
+	assert.Nil(t, h)
+	assert.Contains(t, conn.RemoteAddr().String(), "127.0.0.1:")
+	buf = make([]byte, 6)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "PROXY ", string(buf))
+
+	// Test: a trusted source without a header fails
+	trusted := Options{Trusted: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}}
+	conn = accept(t, trusted, "GET / HTTP/1.1\r\n\r\n")
+	_, err = conn.Read(buf)
+	assert.ErrorIs(t, err, ErrNoHeader)
+}
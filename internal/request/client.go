@@ -0,0 +1,56 @@
+package request
+
+import (
+	"net"
+	"net/netip"
+)
+
+// Forwarded is what trusted proxies reported about the original request,
+// see the forwarded middleware.
+type Forwarded struct {
+	For   netip.Addr // the client
+	Proto string     // "http" or "https", empty if not reported
+	Host  string     // the Host the client asked for, empty if not reported
+}
+
+// ClientIP is the address of the client, as reported by a trusted proxy
+// or else the peer of the connection. It is the zero Addr when unknown,
+// for instance on unix sockets.
+func (r *Request) ClientIP() netip.Addr {
+	if r.Forwarded != nil && r.Forwarded.For.IsValid() {
+		return r.Forwarded.For
+	}
+	if r.Conn == nil {
+		return netip.Addr{}
+	}
+
+	switch addr := r.Conn.RemoteAddr.(type) {
+	case *net.TCPAddr:
+		return addr.AddrPort().Addr().Unmap()
+	case *net.UDPAddr:
+		return addr.AddrPort().Addr().Unmap()
+	default:
+		return netip.Addr{}
+	}
+}
+
+// Scheme is "https" or "http", as reported by a trusted proxy or else
+// depending on the connection.
+func (r *Request) Scheme() string {
+	if r.Forwarded != nil && r.Forwarded.Proto != "" {
+		return r.Forwarded.Proto
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// Host is the host the client asked for, as reported by a trusted proxy
+// or else the Host header.
+func (r *Request) Host() string {
+	if r.Forwarded != nil && r.Forwarded.Host != "" {
+		return r.Forwarded.Host
+	}
+	return r.Headers.Get("Host")
+}
@@ -0,0 +1,19 @@
+package request
+
+import (
+	"net"
+	"time"
+)
+
+// ConnInfo describes the connection a request arrived on. It is shared
+// by all requests on the connection.
+type ConnInfo struct {
+	// ID is unique among the connections of a server.
+	ID uint64
+	// RemoteAddr is the client's address, taken from the PROXY header
+	// when the server reads one.
+	RemoteAddr net.Addr
+	LocalAddr  net.Addr
+	// AcceptedAt is when the server accepted the connection.
+	AcceptedAt time.Time
+}
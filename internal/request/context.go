@@ -0,0 +1,22 @@
+package request
+
+import "context"
+
+// Context is cancelled when the client goes away, writing the response
+// fails, the handler times out or the server shuts down. Middleware adds
+// request-scoped values with SetContext.
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// SetContext replaces the request's context, usually with one derived
+// from Context.
+func (r *Request) SetContext(ctx context.Context) {
+	if ctx == nil {
+		panic("nil context")
+	}
+	r.ctx = ctx
+}
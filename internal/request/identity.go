@@ -0,0 +1,50 @@
+package request
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+)
+
+// ClientIdentity describes the verified certificate a client presented
+// over mutual TLS.
+type ClientIdentity struct {
+	Subject        pkix.Name
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []*url.URL
+	// SPIFFEID is the spiffe:// URI SAN. It is empty unless the
+	// certificate carries exactly one, as the SPIFFE X.509-SVID spec
+	// requires.
+	SPIFFEID    string
+	Certificate *x509.Certificate
+}
+
+// ClientIdentity returns the identity of a verified client certificate,
+// or nil if the client sent none or it was not verified.
+func (r *Request) ClientIdentity() *ClientIdentity {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	id := &ClientIdentity{
+		Subject:        cert.Subject,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		URIs:           cert.URIs,
+		Certificate:    cert,
+	}
+
+	var spiffeIDs []string
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			spiffeIDs = append(spiffeIDs, uri.String())
+		}
+	}
+	if len(spiffeIDs) == 1 {
+		id.SPIFFEID = spiffeIDs[0]
+	}
+
+	return id
+}
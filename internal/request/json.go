@@ -0,0 +1,67 @@
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+const DefaultMaxJSONBytes = 1 << 20
+
+var (
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrBodyTooLarge         = errors.New("request body too large")
+	ErrInvalidJSON          = errors.New("invalid json body")
+)
+
+// DecodeJSON decodes the body into v. The Content-Type must be
+// application/json (or a +json type), the body must not exceed maxBytes
+// (DefaultMaxJSONBytes when maxBytes <= 0), hold a single JSON value and
+// no fields unknown to v.
+func (r *Request) DecodeJSON(v any, maxBytes int) error {
+	if !isJSONContentType(r.Headers.Get("Content-Type")) {
+		return fmt.Errorf("%w: expected application/json", ErrUnsupportedMediaType)
+	}
+
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxJSONBytes
+	}
+
+	if len(r.Body) > maxBytes {
+		return fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, maxBytes)
+	}
+
+	if len(bytes.TrimSpace(r.Body)) == 0 {
+		return fmt.Errorf("%w: body is empty", ErrInvalidJSON)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(r.Body))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("%w: body must contain a single JSON value", ErrInvalidJSON)
+	}
+
+	return nil
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	if charset, ok := params["charset"]; ok && !strings.EqualFold(charset, "utf-8") {
+		return false
+	}
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
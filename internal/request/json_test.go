@@ -0,0 +1,59 @@
+package request
+
+import (
+	"testing"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type coffee struct {
+	Flavour string `json:"flavour"`
+}
+
+func jsonRequest(contentType, body string) *Request {
+	r := &Request{Headers: header.NewHeaders(), Body: []byte(body)}
+	if contentType != "" {
+		r.Headers["content-type"] = contentType
+	}
+	return r
+}
+
+// Test: Valid JSON body
+func TestDecodeJSON(t *testing.T) {
+	var c coffee
+	r := jsonRequest("application/json; charset=utf-8", `{"flavour":"darkmode"}`)
+	require.NoError(t, r.DecodeJSON(&c, 0))
+	assert.Equal(t, "darkmode", c.Flavour)
+
+	r = jsonRequest("application/merge-patch+json", `{"flavour":"light"}`)
+	require.NoError(t, r.DecodeJSON(&c, 0))
+	assert.Equal(t, "light", c.Flavour)
+}
+
+// Test: Rejected JSON bodies
+func TestDecodeJSONErrors(t *testing.T) {
+	var c coffee
+
+	err := jsonRequest("", `{"flavour":"darkmode"}`).DecodeJSON(&c, 0)
+	assert.ErrorIs(t, err, ErrUnsupportedMediaType)
+
+	err = jsonRequest("text/plain", `{"flavour":"darkmode"}`).DecodeJSON(&c, 0)
+	assert.ErrorIs(t, err, ErrUnsupportedMediaType)
+
+	err = jsonRequest("application/json; charset=latin1", `{}`).DecodeJSON(&c, 0)
+	assert.ErrorIs(t, err, ErrUnsupportedMediaType)
+
+	err = jsonRequest("application/json", `{"flavour":"darkmode"}`).DecodeJSON(&c, 10)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	err = jsonRequest("application/json", `{"flavour":"darkmode","sugar":2}`).DecodeJSON(&c, 0)
+	assert.ErrorIs(t, err, ErrInvalidJSON)
+
+	err = jsonRequest("application/json", `{"flavour":"a"}{"flavour":"b"}`).DecodeJSON(&c, 0)
+	assert.ErrorIs(t, err, ErrInvalidJSON)
+
+	err = jsonRequest("application/json", ``).DecodeJSON(&c, 0)
+	assert.ErrorIs(t, err, ErrInvalidJSON)
+}
@@ -0,0 +1,160 @@
+package request
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/harry713j/http-server/internal/header"
+)
+
+const (
+	readBufferSize   = 4096
+	maxPooledBufSize = 64 * 1024
+
+	// DefaultMaxHeaderBytes bounds the request line and headers together
+	DefaultMaxHeaderBytes = 1 << 20
+	// DefaultMaxBodyBytes bounds the Content-Length of a request
+	DefaultMaxBodyBytes = 10 << 20
+)
+
+var ErrHeaderTooLarge = errors.New("request header too large")
+
+var readBufPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, readBufferSize)
+		return &buf
+	},
+}
+
+// Reader reads consecutive requests from one connection. Bytes that
+// arrive after a request, such as a pipelined request, are kept for the
+// next ReadRequest. The read buffer is taken from a pool on the first
+// read and handed back by Release, so an idle Reader holds no buffer.
+type Reader struct {
+	// MaxHeaderBytes and MaxBodyBytes limit each request, zero means
+	// DefaultMaxHeaderBytes and DefaultMaxBodyBytes
+	MaxHeaderBytes int
+	MaxBodyBytes   int
+
+	src    io.Reader
+	bufPtr *[]byte
+	buf    []byte
+	start  int // first unparsed byte
+	end    int // end of the data read so far
+}
+
+func NewReader(src io.Reader) *Reader {
+	return &Reader{src: src}
+}
+
+// ReadRequest reads and parses the next request.
+func (r *Reader) ReadRequest() (*Request, error) {
+	req := Request{
+		state:          requestStateParsingRequestLine,
+		Headers:        header.NewHeaders(),
+		maxHeaderBytes: cmp.Or(r.MaxHeaderBytes, DefaultMaxHeaderBytes),
+		maxBodyBytes:   cmp.Or(r.MaxBodyBytes, DefaultMaxBodyBytes),
+	}
+
+	for {
+		if r.end > r.start {
+			n, err := req.parse(r.buf[r.start:r.end])
+			if err != nil {
+				return nil, err
+			}
+			r.start += n
+
+			if req.state == requestStateDone {
+				return &req, nil
+			}
+
+			// the unparsed rest is a header line that has not ended yet
+			if req.state < requestStateParsingBody && req.headerBytes+r.Buffered() > req.maxHeaderBytes {
+				return nil, ErrHeaderTooLarge
+			}
+		}
+
+		n, err := r.fill()
+		if err != nil {
+			if err == io.EOF {
+				if n > 0 {
+					continue
+				}
+				// the client closed the connection between requests
+				if r.end == 0 && req.state == requestStateParsingRequestLine {
+					return nil, io.EOF
+				}
+				return nil, fmt.Errorf("incomplete request")
+			}
+
+			return nil, err
+		}
+	}
+}
+
+// ReadAhead reads once from the source while no request is being read,
+// to notice a client that closes the connection while its request is
+// handled. What arrives is kept for the next ReadRequest.
+func (r *Reader) ReadAhead() (int, error) {
+	return r.fill()
+}
+
+// fill makes room in the buffer and reads into it once.
+func (r *Reader) fill() (int, error) {
+	if r.buf == nil {
+		r.bufPtr = readBufPool.Get().(*[]byte)
+		r.buf = *r.bufPtr
+	}
+
+	if r.start > 0 {
+		copy(r.buf, r.buf[r.start:r.end])
+		r.end -= r.start
+		r.start = 0
+	}
+
+	// if the buffer is full
+	if r.end == len(r.buf) {
+		r.buf = append(r.buf, make([]byte, len(r.buf))...)
+	}
+
+	n, err := r.src.Read(r.buf[r.end:])
+	r.end += n
+	return n, err
+}
+
+// Buffered returns the number of bytes read past the last request.
+func (r *Reader) Buffered() int {
+	return r.end - r.start
+}
+
+// TakeBuffered returns a copy of the bytes read past the last request and
+// drops them from the Reader, for a caller that takes the connection over.
+func (r *Reader) TakeBuffered() []byte {
+	if r.Buffered() == 0 {
+		return nil
+	}
+
+	b := append([]byte(nil), r.buf[r.start:r.end]...)
+	r.start, r.end = 0, 0
+	return b
+}
+
+// Release returns the read buffer to the pool. Buffered bytes are lost,
+// the Reader may be used again and takes a new buffer when it does.
+func (r *Reader) Release() {
+	if r.buf == nil {
+		return
+	}
+
+	// buffers grown for a huge request are left to the GC
+	if cap(r.buf) <= maxPooledBufSize {
+		*r.bufPtr = r.buf[:cap(r.buf)]
+		readBufPool.Put(r.bufPtr)
+	}
+
+	r.buf, r.bufPtr = nil, nil
+	r.start, r.end = 0, 0
+}
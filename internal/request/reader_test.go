@@ -0,0 +1,79 @@
+package request
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test: Pipelined requests are read one after another
+func TestReaderPipelinedRequests(t *testing.T) {
+	reader := NewReader(&chunkReader{
+		data: "POST /one HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello" +
+			"GET /two HTTP/1.1\r\nHost: localhost\r\n\r\n",
+		numBytesPerRead: 100,
+	})
+	defer reader.Release()
+
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/one", r.RequestLine.RequestTarget)
+	assert.Equal(t, "hello", string(r.Body))
+	assert.Positive(t, reader.Buffered())
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/two", r.RequestLine.RequestTarget)
+	assert.Zero(t, reader.Buffered())
+
+	// Test: a connection closed between requests reports io.EOF
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestReaderLimits(t *testing.T) {
+	// Test: a header line that never ends stops at MaxHeaderBytes
+	reader := NewReader(&chunkReader{
+		data:            "GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("a", 4*readBufferSize),
+		numBytesPerRead: 1000,
+	})
+	reader.MaxHeaderBytes = readBufferSize
+	_, err := reader.ReadRequest()
+	assert.ErrorIs(t, err, ErrHeaderTooLarge)
+	reader.Release()
+
+	// Test: so do many short header lines
+	reader = NewReader(&chunkReader{
+		data:            "GET / HTTP/1.1\r\n" + strings.Repeat("X-Short: a\r\n", 1000) + "\r\n",
+		numBytesPerRead: 100,
+	})
+	reader.MaxHeaderBytes = readBufferSize
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, ErrHeaderTooLarge)
+	reader.Release()
+
+	// Test: a Content-Length over MaxBodyBytes fails before the body is read
+	reader = NewReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\nhello",
+		numBytesPerRead: 100,
+	})
+	reader.MaxBodyBytes = 10
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	reader.Release()
+
+	// Test: requests within the limits are read
+	reader = NewReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: 10\r\n\r\nhelloworld",
+		numBytesPerRead: 100,
+	})
+	reader.MaxHeaderBytes = 64
+	reader.MaxBodyBytes = 10
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "helloworld", string(r.Body))
+	reader.Release()
+}
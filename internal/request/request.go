@@ -1,14 +1,16 @@
 package request
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"strconv"
-	"strings"
-	"unicode"
 
 	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/proxyproto"
 )
 
 const (
@@ -22,7 +24,24 @@ type Request struct {
 	RequestLine RequestLine
 	Headers     header.Headers
 	Body        []byte
-	state       int
+	// Conn describes the connection the request arrived on
+	Conn *ConnInfo
+	// Seq numbers the requests on the connection, starting at 1
+	Seq int
+	// TLS is the negotiated TLS state, nil for plaintext connections
+	TLS *tls.ConnectionState
+	// Proxy is the PROXY protocol header the load balancer sent, its
+	// Source is the real client address. nil without WithProxyProtocol or
+	// for connections from untrusted sources.
+	Proxy *proxyproto.Header
+	// Forwarded is set by the forwarded middleware when trusted proxies
+	// reported the client, see ClientIP, Scheme and Host.
+	Forwarded      *Forwarded
+	ctx            context.Context
+	state          int
+	headerBytes    int // request line and headers parsed so far
+	maxHeaderBytes int // zero for no limit
+	maxBodyBytes   int // zero for no limit
 }
 
 type RequestLine struct {
@@ -36,103 +55,122 @@ var (
 	ErrInvalidHttpMethod  = errors.New("invalid http method")
 	ErrInvalidHttpVersion = errors.New("invalid http version")
 	ErrInvalidTarget      = errors.New("invalid request target")
+	ErrNoCookie           = errors.New("named cookie not present")
 )
 
+// RequestFromReader reads a single request from reader. Bytes read past
+// the end of the request are dropped, use a Reader to keep them.
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buff := make([]byte, 8)
-	readToIndex := 0
-	req := Request{
-		state:   requestStateParsingRequestLine,
-		Headers: header.NewHeaders(),
-	}
-
-	for req.state != requestStateDone {
-		// if the buffere is full
-		if readToIndex == len(buff) {
-			newBuff := make([]byte, 2*len(buff))
-			copy(newBuff, buff)
-			buff = newBuff
-		}
-		// read more data into buffer
-		numOfBytesRead, err := reader.Read(buff[readToIndex:])
-
-		if err != nil {
-			// there is nothing left to read
-			if err == io.EOF {
-				if req.state != requestStateDone {
-					return nil, fmt.Errorf("incomplete request")
-				}
-				break
-			}
+	r := NewReader(reader)
+	defer r.Release()
 
-			return nil, err
-		}
-
-		readToIndex += numOfBytesRead
-
-		numOfBytesParsed, err := req.parse(buff[:readToIndex])
+	return r.ReadRequest()
+}
 
-		if err != nil {
-			return nil, err
-		}
+var (
+	crlf      = []byte("\r\n")
+	headerEnd = []byte("\r\n\r\n")
+)
 
-		if numOfBytesParsed > 0 {
-			copy(buff, buff[numOfBytesParsed:readToIndex])
-			readToIndex -= numOfBytesParsed
-		}
+// methods and versions are interned so parsing a request line only
+// allocates the target
+var (
+	knownMethods  = map[string]string{}
+	knownVersions = map[string]string{"1.1": "1.1", "1.0": "1.0"}
+)
 
+func init() {
+	for _, m := range []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE"} {
+		knownMethods[m] = m
 	}
-
-	return &req, nil
 }
 
-func parseRequestLine(data []byte) (*RequestLine, int, error) {
-	dataStr := string(data)
-	index := strings.Index(dataStr, "\r\n")
+// parseRequestLine returns 0 bytes parsed when data holds no full line.
+// The target is sliced from text when it holds the line, see parse.
+func parseRequestLine(data []byte, text string) (RequestLine, int, error) {
+	index := bytes.Index(data, crlf)
 	if index == -1 {
-		return nil, 0, nil
+		return RequestLine{}, 0, nil
 	}
 
-	line := dataStr[:index]
-	parts := strings.SplitN(line, " ", 3)
+	line := data[:index]
 
-	if len(parts) != 3 {
-		return nil, 0, ErrInvalidRequestline
+	methodEnd := bytes.IndexByte(line, ' ')
+	if methodEnd == -1 {
+		return RequestLine{}, 0, ErrInvalidRequestline
+	}
+	targetEnd := bytes.IndexByte(line[methodEnd+1:], ' ')
+	if targetEnd == -1 {
+		return RequestLine{}, 0, ErrInvalidRequestline
 	}
+	targetEnd += methodEnd + 1
 
-	method := parts[0]
-	target := parts[1]
-	version := parts[2]
+	method := line[:methodEnd]
+	target := line[methodEnd+1 : targetEnd]
+	version := line[targetEnd+1:]
 
-	for _, r := range method {
-		if !unicode.IsUpper(r) {
-			return nil, 0, ErrInvalidHttpMethod
+	for _, c := range method {
+		if c < 'A' || c > 'Z' {
+			return RequestLine{}, 0, ErrInvalidHttpMethod
 		}
 	}
 
-	if !strings.HasPrefix(version, "HTTP/") {
-		return nil, 0, fmt.Errorf("invalid version prefix")
+	versionNumber, ok := bytes.CutPrefix(version, []byte("HTTP/"))
+	if !ok {
+		return RequestLine{}, 0, fmt.Errorf("invalid version prefix")
+	}
+
+	httpVersion, ok := knownVersions[string(versionNumber)]
+	if !ok {
+		return RequestLine{}, 0, fmt.Errorf("unsupported HTTP version: %s", versionNumber)
 	}
 
-	versionNumber := strings.TrimPrefix(version, "HTTP/")
-	if versionNumber != "1.1" && versionNumber != "1.0" {
-		return nil, 0, fmt.Errorf("unsupported HTTP version: %s", versionNumber)
+	if len(target) == 0 || target[0] != '/' {
+		return RequestLine{}, 0, ErrInvalidTarget
 	}
 
-	if !strings.HasPrefix(target, "/") {
-		return nil, 0, ErrInvalidTarget
+	var targetStr string
+	if targetEnd <= len(text) {
+		targetStr = text[methodEnd+1 : targetEnd]
+	} else {
+		targetStr = string(target)
 	}
 
-	return &RequestLine{Method: method, RequestTarget: target, HttpVersion: versionNumber}, index + 2, nil
+	return RequestLine{Method: intern(knownMethods, method), RequestTarget: targetStr, HttpVersion: httpVersion}, index + 2, nil
+}
+
+func intern(known map[string]string, b []byte) string {
+	if s, ok := known[string(b)]; ok {
+		return s
+	}
+	return string(b)
 }
 
 func (r *Request) parse(data []byte) (int, error) {
 	totalBytesParsed := 0
 
+	// when the request line and headers arrived in one piece they are
+	// copied to a single string, the target and the header values are
+	// sliced from it instead of being copied one by one
+	var text string
+	if r.state == requestStateParsingRequestLine {
+		if end := bytes.Index(data, headerEnd); end != -1 && (r.maxHeaderBytes == 0 || end+len(headerEnd) <= r.maxHeaderBytes) {
+			text = string(data[:end+len(headerEnd)])
+		}
+	}
+
 	for r.state != requestStateDone {
-		numOfBytesParsed, err := r.parseSingle(data[totalBytesParsed:])
+		inHeader := r.state < requestStateParsingBody
+		numOfBytesParsed, err := r.parseSingle(data[totalBytesParsed:], text[min(totalBytesParsed, len(text)):])
 		totalBytesParsed += numOfBytesParsed
 
+		if inHeader && err == nil {
+			r.headerBytes += numOfBytesParsed
+			if r.maxHeaderBytes > 0 && r.headerBytes > r.maxHeaderBytes {
+				err = ErrHeaderTooLarge
+			}
+		}
+
 		if err != nil {
 			return totalBytesParsed, err
 		}
@@ -145,24 +183,26 @@ func (r *Request) parse(data []byte) (int, error) {
 	return totalBytesParsed, nil
 }
 
-func (r *Request) parseSingle(data []byte) (int, error) {
+// parseSingle parses the next part of the request from data. text is
+// empty or holds the leading bytes of data.
+func (r *Request) parseSingle(data []byte, text string) (int, error) {
 	switch r.state {
 	case requestStateParsingRequestLine:
-		reqLine, n, err := parseRequestLine(data)
+		reqLine, n, err := parseRequestLine(data, text)
 
 		if err != nil {
 			return 0, err
 		}
 
-		if reqLine == nil {
+		if n == 0 {
 			return 0, nil
 		}
 
-		r.RequestLine = *reqLine
+		r.RequestLine = reqLine
 		r.state = requestStateParsingHeaders
 		return n, nil
 	case requestStateParsingHeaders:
-		n, done, err := r.Headers.Parse(data)
+		n, done, err := r.Headers.ParseText(data, text)
 
 		if err != nil {
 			return 0, err
@@ -188,6 +228,12 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		if err != nil {
 			return 0, errors.New("invalid content length " + err.Error())
 		}
+		if contentLength < 0 {
+			return 0, errors.New("invalid content length " + contentLengthStr)
+		}
+		if r.maxBodyBytes > 0 && contentLength > r.maxBodyBytes {
+			return 0, fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, r.maxBodyBytes)
+		}
 
 		remaining := contentLength - len(r.Body)
 		if remaining <= 0 {
@@ -195,12 +241,13 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 			return 0, nil
 		}
 
-		// Only take up to 'remaining' bytes from data
-		take := len(data)
-		if take > remaining {
-			return 0, fmt.Errorf("body longer than Content-Length")
-		}
+		// Only take up to 'remaining' bytes from data, the rest belongs to
+		// the next request on the connection
+		take := min(len(data), remaining)
 
+		if r.Body == nil && contentLength <= maxPooledBufSize {
+			r.Body = make([]byte, 0, contentLength)
+		}
 		r.Body = append(r.Body, data[:take]...)
 
 		if len(r.Body) == contentLength {
@@ -213,3 +260,17 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	}
 
 }
+
+func (r *Request) Cookies() []*header.Cookie {
+	return r.Headers.Cookies()
+}
+
+func (r *Request) Cookie(name string) (*header.Cookie, error) {
+	for _, c := range r.Headers.Cookies() {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+
+	return nil, ErrNoCookie
+}
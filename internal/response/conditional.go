@@ -0,0 +1,133 @@
+package response
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/harry713j/http-server/internal/header"
+)
+
+// HashETag returns a strong entity tag derived from the content.
+func HashETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// HashReaderETag is HashETag for content read from r, without holding all
+// of it in memory.
+func HashReaderETag(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`, nil
+}
+
+// ModTimeETag returns an entity tag derived from modification time and
+// size, cheap enough for files that are streamed from disk.
+func ModTimeETag(modTime time.Time, size int64, weak bool) string {
+	etag := fmt.Sprintf(`"%x-%x"`, modTime.UnixNano(), size)
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// CheckPreconditions evaluates If-Match, If-Unmodified-Since,
+// If-None-Match and If-Modified-Since in RFC 9110 order against the
+// ETag and Last-Modified in headers. It returns StatusNotModified,
+// StatusPreconditionFailed, or 0 when the request should proceed.
+func CheckPreconditions(reqHeaders, headers header.Headers, method string) StatusCode {
+	etag := headers.Get("ETag")
+	lastModified, hasLastModified := parseHTTPDate(headers.Get("Last-Modified"))
+
+	if ifMatch := reqHeaders.Get("If-Match"); ifMatch != "" {
+		if !etagListMatches(ifMatch, etag, header.StrongMatch) {
+			return StatusPreconditionFailed
+		}
+	} else if since, ok := parseHTTPDate(reqHeaders.Get("If-Unmodified-Since")); ok && hasLastModified {
+		if lastModified.After(since) {
+			return StatusPreconditionFailed
+		}
+	}
+
+	isGetOrHead := method == "GET" || method == "HEAD"
+
+	if ifNoneMatch := reqHeaders.Get("If-None-Match"); ifNoneMatch != "" {
+		if etagListMatches(ifNoneMatch, etag, header.WeakMatch) {
+			if isGetOrHead {
+				return StatusNotModified
+			}
+			return StatusPreconditionFailed
+		}
+	} else if since, ok := parseHTTPDate(reqHeaders.Get("If-Modified-Since")); ok && hasLastModified && isGetOrHead {
+		if !lastModified.After(since) {
+			return StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// EvaluatePreconditions runs CheckPreconditions and, when the request
+// should not proceed, writes the 304 or 412 response and returns true.
+// Handlers serving any representation can set ETag and Last-Modified in
+// headers and call it before writing the body.
+func EvaluatePreconditions(w *Writer, reqHeaders, headers header.Headers, method string) (bool, error) {
+	status := CheckPreconditions(reqHeaders, headers, method)
+	if status == 0 {
+		return false, nil
+	}
+
+	h := GetDefaultHeaders(0)
+	h.Remove("Content-Type")
+
+	if status == StatusNotModified {
+		// a 304 carries the validators and caching headers a 200 would
+		for _, key := range []string{"ETag", "Last-Modified", "Cache-Control", "Expires", "Vary", "Content-Location"} {
+			if value := headers.Get(key); value != "" {
+				h.Add(key, value)
+			}
+		}
+	} else {
+		h.Add("Content-Length", "0")
+	}
+
+	if err := w.WriteStatusLine(status); err != nil {
+		return true, err
+	}
+
+	return true, w.WriteHeaders(h)
+}
+
+func etagListMatches(value, etag string, match func(a, b string) bool) bool {
+	for _, candidate := range header.ParseETags(value) {
+		if candidate == "*" {
+			return true
+		}
+		if match(candidate, etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// httpDateFormats are IMF-fixdate and the two obsolete formats recipients
+// must still accept, RFC 9110 section 5.6.7.
+var httpDateFormats = []string{header.TimeFormat, time.RFC850, time.ANSIC}
+
+func parseHTTPDate(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	for _, layout := range httpDateFormats {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
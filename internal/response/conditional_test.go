@@ -0,0 +1,45 @@
+package response
+
+import (
+	"testing"
+	"time"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHTTPDate(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"IMF-fixdate", "Sun, 06 Nov 1994 08:49:37 GMT", true},
+		{"RFC 850", "Sunday, 06-Nov-94 08:49:37 GMT", true},
+		{"asctime", "Sun Nov  6 08:49:37 1994", true},
+		{"empty", "", false},
+		{"garbage", "yesterday", false},
+	}
+
+	want := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Test: all three formats of RFC 9110 give the same instant
+			got, ok := parseHTTPDate(tt.value)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.True(t, want.Equal(got), got)
+			}
+		})
+	}
+}
+
+// Test: If-Modified-Since in the obsolete formats still yields a 304
+func TestCheckPreconditionsObsoleteDates(t *testing.T) {
+	headers := header.Headers{"Last-Modified": "Sun, 06 Nov 1994 08:49:37 GMT"}
+
+	for _, since := range []string{"Sunday, 06-Nov-94 08:49:37 GMT", "Sun Nov  6 08:49:37 1994"} {
+		status := CheckPreconditions(header.Headers{"if-modified-since": since}, headers, "GET")
+		assert.Equal(t, StatusNotModified, status, since)
+	}
+}
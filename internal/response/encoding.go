@@ -0,0 +1,100 @@
+package response
+
+import (
+	"errors"
+	"io"
+)
+
+// BodyEncoder wraps dst with a content coding such as gzip. Closing the
+// returned writer must flush everything to dst without closing dst.
+type BodyEncoder func(dst io.Writer) io.WriteCloser
+
+// SetBodyEncoder makes every body write go through the encoder. It must
+// be called before the headers are written, usually from a
+// BeforeWriteHeaders hook that also sets Content-Encoding. When the
+// headers say Transfer-Encoding: chunked the encoded output is chunked,
+// so fixed-length bodies written with WriteBody are converted as well.
+func (w *Writer) SetBodyEncoder(enc BodyEncoder) error {
+	if w.state != StateInit && w.state != StateWrittenStatus {
+		return errors.New("body encoder must be set before headers are written")
+	}
+
+	w.newEncoder = enc
+	return nil
+}
+
+// Finish completes a body that was streamed with Write through a body
+// encoder and closes a trailer section left open. The server calls it
+// once the handler returns.
+func (w *Writer) Finish() error {
+	if w.trailerEnd {
+		w.trailerEnd = false
+		_, err := io.WriteString(w.w, "\r\n")
+		return err
+	}
+
+	if w.state != StateWrittenHeaders || w.encoder == nil {
+		return nil
+	}
+
+	w.state = StateDone
+	return w.finishEncoder()
+}
+
+func (w *Writer) finishEncoder() error {
+	if w.encoder == nil {
+		return nil
+	}
+
+	err := w.encoder.Close()
+	w.encoder = nil
+	if err != nil {
+		return err
+	}
+
+	if w.chunked {
+		_, err = io.WriteString(w.w, "0\r\n\r\n")
+	}
+	return err
+}
+
+func (w *Writer) writeEncodedChunk(p []byte) (int, error) {
+	n, err := w.encoder.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	// keep streaming responses streaming instead of waiting for the
+	// encoder's internal buffer to fill up
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return n, err
+		}
+	}
+
+	w.state = StateWrittenHeaders
+	return n, nil
+}
+
+// chunkWriter frames every write as one chunk of a chunked body.
+type chunkWriter struct {
+	w io.Writer
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if _, err := c.w.Write(appendChunkHeader(nil, len(p))); err != nil {
+		return 0, err
+	}
+
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	_, err = io.WriteString(c.w, "\r\n")
+	return n, err
+}
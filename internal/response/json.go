@@ -0,0 +1,94 @@
+package response
+
+import (
+	"encoding/json"
+)
+
+// Problem is an RFC 9457 problem details object.
+type Problem struct {
+	Type     string
+	Title    string
+	Status   StatusCode
+	Detail   string
+	Instance string
+	// Extensions are extra members serialized next to the standard ones
+	Extensions map[string]any
+}
+
+// MarshalJSON writes the standard members next to the extensions. An
+// extension named like a standard member is dropped, even when that member
+// is empty.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		switch k {
+		case "type", "title", "status", "detail", "instance":
+			continue
+		}
+		m[k] = v
+	}
+
+	if p.Type != "" {
+		m["type"] = p.Type
+	}
+	if p.Title != "" {
+		m["title"] = p.Title
+	}
+	if p.Status != 0 {
+		m["status"] = int(p.Status)
+	}
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+
+	return json.Marshal(m)
+}
+
+// WriteJSON writes a complete response with v encoded as the JSON body.
+func (w *Writer) WriteJSON(statusCode StatusCode, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return w.writeJSONBody(statusCode, "application/json; charset=utf-8", body)
+}
+
+// WriteProblem writes a complete application/problem+json response.
+func (w *Writer) WriteProblem(p Problem) error {
+	if p.Status == 0 {
+		p.Status = StatusInternalServerError
+	}
+
+	if p.Title == "" {
+		p.Title = StatusText(p.Status)
+	}
+
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	return w.writeJSONBody(p.Status, "application/problem+json", body)
+}
+
+func (w *Writer) writeJSONBody(statusCode StatusCode, contentType string, body []byte) error {
+	body = append(body, '\n')
+
+	if err := w.WriteStatusLine(statusCode); err != nil {
+		return err
+	}
+
+	h := GetDefaultHeaders(len(body))
+	h.Add("Content-Type", contentType)
+
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+
+	_, err := w.WriteBody(body)
+	return err
+}
@@ -0,0 +1,83 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readJSON parses a response written to conn and decodes its body.
+func readJSON(t *testing.T, conn *bytes.Buffer) (*http.Response, map[string]any) {
+	t.Helper()
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(len(body)), resp.Header.Get("Content-Length"))
+
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(body, &m))
+	return resp, m
+}
+
+// Test: WriteJSON sets the status, media type and length of the body
+func TestWriteJSON(t *testing.T) {
+	var conn bytes.Buffer
+	require.NoError(t, NewWriter(&conn).WriteJSON(StatusOk, map[string]any{"flavour": "darkmode"}))
+
+	resp, body := readJSON(t, &conn)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, map[string]any{"flavour": "darkmode"}, body)
+
+	// Test: values that can't be encoded leave the response unstarted
+	w := NewWriter(&conn)
+	assert.Error(t, w.WriteJSON(StatusOk, func() {}))
+	assert.False(t, w.Started())
+}
+
+func TestWriteProblem(t *testing.T) {
+	var conn bytes.Buffer
+	require.NoError(t, NewWriter(&conn).WriteProblem(Problem{
+		Type:     "https://example.com/probs/out-of-credit",
+		Status:   StatusForbidden,
+		Detail:   "Your balance is 30, but that costs 50.",
+		Instance: "/account/12345/msgs/abc",
+		Extensions: map[string]any{
+			"balance": 30,
+			"status":  500,
+			"title":   "overridden",
+		},
+	}))
+
+	// Test: members use the RFC 9457 names, the title defaults to the
+	// status text and extensions can't replace standard members
+	resp, body := readJSON(t, &conn)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, map[string]any{
+		"type":     "https://example.com/probs/out-of-credit",
+		"title":    "Forbidden",
+		"status":   float64(403),
+		"detail":   "Your balance is 30, but that costs 50.",
+		"instance": "/account/12345/msgs/abc",
+		"balance":  float64(30),
+	}, body)
+
+	// Test: not even when the standard member is empty
+	conn.Reset()
+	require.NoError(t, NewWriter(&conn).WriteProblem(Problem{
+		Extensions: map[string]any{"type": "https://evil.example", "detail": "injected"},
+	}))
+	resp, body = readJSON(t, &conn)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, map[string]any{"title": "Internal Server Error", "status": float64(500)}, body)
+}
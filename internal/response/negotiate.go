@@ -0,0 +1,73 @@
+package response
+
+import (
+	"strings"
+
+	"github.com/harry713j/http-server/internal/header"
+)
+
+// Negotiate picks one of the offers based on the request header field,
+// one of Accept, Accept-Language, Accept-Encoding or Accept-Charset, and
+// adds field to the response's Vary header. It returns "" when nothing
+// offered is acceptable, handlers usually answer that with 406.
+func Negotiate(w *Writer, reqHeaders header.Headers, field string, offers ...string) string {
+	w.AddVary(field)
+
+	value := reqHeaders.Get(field)
+
+	switch strings.ToLower(field) {
+	case "accept":
+		return header.NegotiateMediaType(value, offers...)
+	case "accept-language":
+		return header.NegotiateLanguage(value, offers...)
+	case "accept-encoding":
+		return header.NegotiateEncoding(value, offers...)
+	case "accept-charset":
+		return header.NegotiateCharset(value, offers...)
+	default:
+		return ""
+	}
+}
+
+// addVary merges fields into the Vary header, whatever case its key has.
+func addVary(h header.Headers, fields []string) {
+	if len(fields) == 0 {
+		return
+	}
+
+	key := "Vary"
+	for k := range h {
+		if strings.EqualFold(k, "Vary") {
+			key = k
+			break
+		}
+	}
+
+	existing := []string{}
+	for _, v := range strings.Split(h[key], ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			existing = append(existing, v)
+		}
+	}
+
+	if containsFold(existing, "*") {
+		return
+	}
+
+	for _, field := range fields {
+		if !containsFold(existing, field) {
+			existing = append(existing, field)
+		}
+	}
+
+	h[key] = strings.Join(existing, ", ")
+}
+
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
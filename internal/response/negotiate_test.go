@@ -0,0 +1,89 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeVary writes a response with h after w's Vary fields were recorded
+// by record and returns the Vary values the client sees.
+func writeVary(t *testing.T, h header.Headers, record func(w *Writer)) []string {
+	t.Helper()
+
+	var conn bytes.Buffer
+	w := NewWriter(&conn)
+	record(w)
+
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(h))
+
+	resp, err := http.ReadResponse(bufio.NewReader(&conn), nil)
+	require.NoError(t, err)
+	return resp.Header.Values("Vary")
+}
+
+func TestNegotiate(t *testing.T) {
+	reqHeaders := header.Headers{
+		"accept":          "application/json;q=0.5, text/html",
+		"accept-language": "de, en;q=0.5",
+		"accept-encoding": "gzip;q=0",
+	}
+
+	var chosen []string
+	vary := writeVary(t, GetDefaultHeaders(0), func(w *Writer) {
+		chosen = append(chosen,
+			Negotiate(w, reqHeaders, "Accept", "application/json", "text/html"),
+			Negotiate(w, reqHeaders, "Accept-Language", "en", "de"),
+			Negotiate(w, reqHeaders, "Accept-Encoding", "gzip"),
+			Negotiate(w, reqHeaders, "Accept-Charset", "utf-8"),
+		)
+	})
+
+	// Test: each field picks by its own rules, "" when nothing fits
+	assert.Equal(t, []string{"text/html", "de", "", "utf-8"}, chosen)
+
+	// Test: every negotiated field ends up in Vary once
+	assert.Equal(t, []string{"Accept, Accept-Language, Accept-Encoding, Accept-Charset"}, vary)
+
+	// Test: unknown fields match nothing but still vary
+	vary = writeVary(t, GetDefaultHeaders(0), func(w *Writer) {
+		assert.Equal(t, "", Negotiate(w, reqHeaders, "X-Flavour", "vanilla"))
+	})
+	assert.Equal(t, []string{"X-Flavour"}, vary)
+}
+
+func TestAddVary(t *testing.T) {
+	// Test: fields merge with a Vary the handler set, whatever its case
+	h := GetDefaultHeaders(0)
+	h["VARY"] = "Origin, accept"
+	vary := writeVary(t, h, func(w *Writer) {
+		w.AddVary("Accept", "Accept-Encoding")
+	})
+	assert.Equal(t, []string{"Origin, accept, Accept-Encoding"}, vary)
+
+	// Test: the same field added twice is listed once
+	vary = writeVary(t, GetDefaultHeaders(0), func(w *Writer) {
+		w.AddVary("Accept")
+		w.AddVary("accept", "Cookie")
+		w.AddVary("Cookie")
+	})
+	assert.Equal(t, []string{"Accept, Cookie"}, vary)
+
+	// Test: Vary: * already covers everything
+	h = GetDefaultHeaders(0)
+	h["vary"] = "*"
+	vary = writeVary(t, h, func(w *Writer) {
+		w.AddVary("Accept")
+	})
+	assert.Equal(t, []string{"*"}, vary)
+
+	// Test: without fields no Vary is added
+	vary = writeVary(t, GetDefaultHeaders(0), func(w *Writer) {})
+	assert.Empty(t, vary)
+}
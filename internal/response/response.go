@@ -1,8 +1,9 @@
 package response
 
 import (
-	"fmt"
 	"io"
+	"strconv"
+	"sync"
 
 	"github.com/harry713j/http-server/internal/header"
 )
@@ -10,39 +11,76 @@ import (
 type StatusCode int
 
 const (
-	StatusOk                  StatusCode = 200
-	StatusBadRequest          StatusCode = 400
-	StatusInternalServerError StatusCode = 500
+	StatusSwitchingProtocols    StatusCode = 101
+	StatusOk                    StatusCode = 200
+	StatusNoContent             StatusCode = 204
+	StatusPartialContent        StatusCode = 206
+	StatusMovedPermanently      StatusCode = 301
+	StatusNotModified           StatusCode = 304
+	StatusBadRequest            StatusCode = 400
+	StatusForbidden             StatusCode = 403
+	StatusNotFound              StatusCode = 404
+	StatusMethodNotAllowed      StatusCode = 405
+	StatusNotAcceptable         StatusCode = 406
+	StatusPreconditionFailed    StatusCode = 412
+	StatusRequestEntityTooLarge StatusCode = 413
+	StatusUnsupportedMediaType  StatusCode = 415
+	StatusRangeNotSatisfiable   StatusCode = 416
+	StatusUnprocessableEntity   StatusCode = 422
+	StatusTooManyRequests       StatusCode = 429
+	StatusHeaderFieldsTooLarge  StatusCode = 431
+	StatusInternalServerError   StatusCode = 500
+	StatusServiceUnavailable    StatusCode = 503
 )
 
-func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
-	var reason string
-	switch statusCode {
-	case StatusOk:
-		reason = "OK"
-	case StatusBadRequest:
-		reason = "Bad Request"
-	case StatusInternalServerError:
-		reason = "Internal Server Error"
-	default:
-		reason = ""
-	}
-
-	if reason == "" {
-		_, err := fmt.Fprintf(w, "HTTP/1.1 %d \r\n", statusCode)
+var statusText = map[StatusCode]string{
+	StatusSwitchingProtocols:    "Switching Protocols",
+	StatusOk:                    "OK",
+	StatusNoContent:             "No Content",
+	StatusPartialContent:        "Partial Content",
+	StatusMovedPermanently:      "Moved Permanently",
+	StatusNotModified:           "Not Modified",
+	StatusBadRequest:            "Bad Request",
+	StatusForbidden:             "Forbidden",
+	StatusNotFound:              "Not Found",
+	StatusMethodNotAllowed:      "Method Not Allowed",
+	StatusNotAcceptable:         "Not Acceptable",
+	StatusPreconditionFailed:    "Precondition Failed",
+	StatusRequestEntityTooLarge: "Request Entity Too Large",
+	StatusUnsupportedMediaType:  "Unsupported Media Type",
+	StatusRangeNotSatisfiable:   "Range Not Satisfiable",
+	StatusUnprocessableEntity:   "Unprocessable Entity",
+	StatusTooManyRequests:       "Too Many Requests",
+	StatusHeaderFieldsTooLarge:  "Request Header Fields Too Large",
+	StatusInternalServerError:   "Internal Server Error",
+	StatusServiceUnavailable:    "Service Unavailable",
+}
 
-		return err
-	}
+// StatusText returns the reason phrase for the status code, or "" if the
+// code is unknown.
+func StatusText(statusCode StatusCode) string {
+	return statusText[statusCode]
+}
 
-	_, err := fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n", statusCode, reason)
+func WriteStatusLine(w io.Writer, statusCode StatusCode) error {
+	_, err := w.Write(AppendStatusLine(nil, statusCode))
 	return err
 }
 
+// AppendStatusLine appends "HTTP/1.1 <code> <reason>\r\n" to b.
+func AppendStatusLine(b []byte, statusCode StatusCode) []byte {
+	b = append(b, "HTTP/1.1 "...)
+	b = strconv.AppendInt(b, int64(statusCode), 10)
+	b = append(b, ' ')
+	b = append(b, StatusText(statusCode)...)
+	return append(b, "\r\n"...)
+}
+
 func GetDefaultHeaders(contentLen int) header.Headers {
 	h := header.NewHeaders()
 
 	if contentLen > 0 {
-		h["Content-Length"] = fmt.Sprintf("%d", contentLen)
+		h["Content-Length"] = strconv.Itoa(contentLen)
 	}
 	h["Connection"] = "close"
 	h["Content-Type"] = "text/plain"
@@ -51,11 +89,46 @@ func GetDefaultHeaders(contentLen int) header.Headers {
 }
 
 func WriteHeaders(w io.Writer, headers header.Headers) error {
-	for key, value := range headers {
-		if _, err := fmt.Fprintf(w, "%s: %s\r\n", key, value); err != nil {
-			return err
-		}
+	return WriteHeadersWithCookies(w, headers, nil)
+}
+
+// WriteHeadersWithCookies writes the headers followed by one Set-Cookie
+// line per cookie, since Set-Cookie values can't be comma-joined. The
+// whole block is serialized first and written with a single Write.
+func WriteHeadersWithCookies(w io.Writer, headers header.Headers, cookies []*header.Cookie) error {
+	buf := headerBufPool.Get().(*[]byte)
+	defer headerBufPool.Put(buf)
+
+	b := AppendHeaders((*buf)[:0], headers)
+	for _, c := range cookies {
+		b = appendHeaderLine(b, "Set-Cookie", c.String())
 	}
-	_, err := io.WriteString(w, "\r\n")
+	b = append(b, "\r\n"...)
+
+	_, err := w.Write(b)
+	*buf = b
 	return err
 }
+
+var headerBufPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, 1024)
+		return &buf
+	},
+}
+
+// AppendHeaders appends one "key: value\r\n" line per header to b,
+// without the terminating empty line.
+func AppendHeaders(b []byte, headers header.Headers) []byte {
+	for key, value := range headers {
+		b = appendHeaderLine(b, key, value)
+	}
+	return b
+}
+
+func appendHeaderLine(b []byte, key, value string) []byte {
+	b = append(b, key...)
+	b = append(b, ": "...)
+	b = append(b, value...)
+	return append(b, "\r\n"...)
+}
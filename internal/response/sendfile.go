@@ -0,0 +1,49 @@
+package response
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+)
+
+var copyBufPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 32*1024)
+		return &buf
+	},
+}
+
+// copyBody copies src to dst without going through user space when it
+// can: a *net.TCPConn's ReadFrom uses sendfile(2) for *os.File sources,
+// also behind an io.LimitedReader for ranges, and splice(2) for plain
+// TCP and Unix socket sources on Linux. Everything else is copied through
+// a pooled buffer.
+func copyBody(dst io.Writer, src io.Reader) (int64, error) {
+	if rf, ok := dst.(io.ReaderFrom); ok && isZeroCopySource(src) {
+		return rf.ReadFrom(src)
+	}
+
+	return bufferedCopy(dst, src)
+}
+
+func bufferedCopy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(buf)
+
+	// hide ReadFrom/WriteTo so CopyBuffer really uses buf
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
+
+func isZeroCopySource(src io.Reader) bool {
+	if lr, ok := src.(*io.LimitedReader); ok {
+		src = lr.R
+	}
+
+	switch src.(type) {
+	case *os.File, *net.TCPConn, *net.UnixConn:
+		return true
+	default:
+		return false
+	}
+}
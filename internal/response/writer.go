@@ -1,9 +1,13 @@
 package response
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
-	"fmt"
 	"io"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/harry713j/http-server/internal/header"
 )
@@ -18,14 +22,77 @@ const (
 )
 
 type Writer struct {
-	w     io.Writer
-	state writerState
+	w             io.Writer
+	conn          io.Writer     // unbuffered destination behind bw
+	bw            *bufio.Writer // pooled, only set by NewBufferedWriter
+	state         writerState
+	status        StatusCode
+	cookies       []*header.Cookie
+	beforeHeaders []func(h header.Headers)
+	vary          []string
+	newEncoder    BodyEncoder
+	encoder       io.WriteCloser // set once headers are written with newEncoder
+	chunked       bool
+	trailers      bool         // headers announced a Trailer field
+	trailerEnd    bool         // last chunk written, trailer section still open
+	buffered      bytes.Buffer // body written with Write before the status line
 }
 
+var bufWriterPool = sync.Pool{
+	New: func() any {
+		return bufio.NewWriterSize(nil, 4096)
+	},
+}
+
+// NewWriter wraps w in a Writer. If w already is a *Writer it is returned
+// as is, so middleware and handlers share cookies and header hooks.
 func NewWriter(w io.Writer) *Writer {
+	if rw, ok := w.(*Writer); ok {
+		return rw
+	}
 	return &Writer{w: w, state: StateInit}
 }
 
+// NewBufferedWriter wraps conn in a pooled bufio.Writer so a response
+// costs as few writes as possible. Nothing reaches conn before Flush, a
+// full buffer or a zero-copy body. Call Release once done.
+func NewBufferedWriter(conn io.Writer) *Writer {
+	bw := bufWriterPool.Get().(*bufio.Writer)
+	bw.Reset(conn)
+	return &Writer{w: bw, conn: conn, bw: bw, state: StateInit}
+}
+
+// Flush sends everything written so far to the connection, including
+// data held back by a body encoder. Streaming handlers call it to push
+// each part out as soon as it is ready.
+func (w *Writer) Flush() error {
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if w.bw != nil {
+		return w.bw.Flush()
+	}
+	return nil
+}
+
+// Release flushes the Writer and returns its buffer to the pool. The
+// Writer must not be used afterwards.
+func (w *Writer) Release() error {
+	if w.bw == nil {
+		return nil
+	}
+
+	err := w.bw.Flush()
+	w.bw.Reset(nil)
+	bufWriterPool.Put(w.bw)
+	w.bw = nil
+	w.w = w.conn
+	return err
+}
+
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 	if w.state != StateInit {
 		return errors.New("status line must be written first")
@@ -33,31 +100,154 @@ func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 	if err := WriteStatusLine(w.w, statusCode); err != nil {
 		return err
 	}
+	w.status = statusCode
 	w.state = StateWrittenStatus
 	return nil
 }
+
 func (w *Writer) WriteHeaders(headers header.Headers) error {
 	if w.state != StateWrittenStatus {
 		return errors.New("header must be written after status line")
 	}
 
-	if err := WriteHeaders(w.w, headers); err != nil {
+	for _, fn := range w.beforeHeaders {
+		fn(headers)
+	}
+
+	addVary(headers, w.vary)
+
+	if err := WriteHeadersWithCookies(w.w, headers, w.cookies); err != nil {
 		return err
 	}
 
+	w.trailers = headers.Get("Trailer") != ""
+
+	if w.newEncoder != nil {
+		w.chunked = strings.Contains(strings.ToLower(headers.Get("Transfer-Encoding")), "chunked")
+
+		var dst io.Writer = w.w
+		if w.chunked {
+			dst = &chunkWriter{w: w.w}
+		}
+		w.encoder = w.newEncoder(dst)
+	}
+
 	w.state = StateWrittenHeaders
 	return nil
 }
+
+// SetCookie queues a Set-Cookie header to be sent with WriteHeaders.
+func (w *Writer) SetCookie(c *header.Cookie) error {
+	if w.state != StateInit && w.state != StateWrittenStatus {
+		return errors.New("cookies must be set before headers are written")
+	}
+
+	if err := c.Valid(); err != nil {
+		return err
+	}
+
+	w.cookies = append(w.cookies, c)
+	return nil
+}
+
+// BeforeWriteHeaders registers fn to run right before the headers are
+// serialized. fn may modify the headers or call SetCookie.
+func (w *Writer) BeforeWriteHeaders(fn func(h header.Headers)) {
+	w.beforeHeaders = append(w.beforeHeaders, fn)
+}
+
+// AddVary records request header names the response depends on. They are
+// merged into the Vary header when the headers are written.
+func (w *Writer) AddVary(fields ...string) {
+	for _, field := range fields {
+		if !containsFold(w.vary, field) {
+			w.vary = append(w.vary, field)
+		}
+	}
+}
+
+// Write makes Writer an io.Writer. Bytes written before the status line
+// are buffered and sent by the server as a 200 response body, bytes
+// written after the headers go straight to the connection.
+func (w *Writer) Write(p []byte) (int, error) {
+	switch w.state {
+	case StateInit:
+		return w.buffered.Write(p)
+	case StateWrittenHeaders, StateDone:
+		if w.encoder != nil {
+			return w.encoder.Write(p)
+		}
+		return w.w.Write(p)
+	default:
+		return 0, errors.New("body must be written after headers")
+	}
+}
+
+// Started reports whether the status line has already been written.
+func (w *Writer) Started() bool {
+	return w.state != StateInit
+}
+
+// Status returns the status code written, or 0 if none was written yet.
+func (w *Writer) Status() StatusCode {
+	return w.status
+}
+
+// Buffered returns the body bytes written with Write before the status line.
+func (w *Writer) Buffered() []byte {
+	return w.buffered.Bytes()
+}
+
 func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.state != StateWrittenHeaders {
 		return 0, errors.New("body must be written after headers")
 	}
 
+	if w.encoder != nil {
+		w.state = StateDone
+		if _, err := w.encoder.Write(p); err != nil {
+			return 0, err
+		}
+		if err := w.finishEncoder(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
 	n, err := w.w.Write(p)
 	w.state = StateDone
 	return n, err
 }
 
+// WriteBodyFrom streams the whole body from r instead of holding it in
+// memory. The headers must already announce its length or chunking.
+func (w *Writer) WriteBodyFrom(r io.Reader) (int64, error) {
+	if w.state != StateWrittenHeaders {
+		return 0, errors.New("body must be written after headers")
+	}
+
+	w.state = StateDone
+
+	if w.encoder != nil {
+		n, err := bufferedCopy(w.encoder, r)
+		if err != nil {
+			return n, err
+		}
+		return n, w.finishEncoder()
+	}
+
+	// the zero-copy path writes to the socket directly, so whatever is
+	// buffered, at least the headers, has to go out first
+	if w.bw != nil && isZeroCopySource(r) {
+		if err := w.bw.Flush(); err != nil {
+			return 0, err
+		}
+		return copyBody(w.conn, r)
+	}
+
+	return copyBody(w.w, r)
+}
+
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	// chunk format
 	// 	<size in hex>\r\n
@@ -66,9 +256,11 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 		return 0, errors.New("chunked body must be written after headers")
 	}
 
-	chunkedHeader := fmt.Sprintf("%x\r\n", len(p))
+	if w.encoder != nil {
+		return w.writeEncodedChunk(p)
+	}
 
-	if _, err := w.w.Write([]byte(chunkedHeader)); err != nil {
+	if _, err := w.w.Write(appendChunkHeader(nil, len(p))); err != nil {
 		return 0, err
 	}
 
@@ -78,7 +270,7 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 		return n, err
 	}
 
-	if _, err := w.w.Write([]byte("\r\n")); err != nil {
+	if _, err := io.WriteString(w.w, "\r\n"); err != nil {
 		return 0, err
 	}
 
@@ -86,24 +278,45 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	return n, nil
 }
 
+// WriteChunkedBodyDone writes the last chunk. When the headers announced
+// a Trailer field the trailer section is left open for WriteTrailers.
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
 	if w.state != StateWrittenHeaders {
-		return 0, fmt.Errorf("cannot finish chunked body before writing chunks")
+		return 0, errors.New("cannot finish chunked body before writing chunks")
 	}
-	n, err := w.w.Write([]byte("0\r\n\r\n"))
+	if w.encoder != nil {
+		if err := w.encoder.Close(); err != nil {
+			return 0, err
+		}
+		w.encoder = nil
+	}
+
+	lastChunk := "0\r\n\r\n"
+	if w.trailers {
+		lastChunk = "0\r\n"
+	}
+
+	n, err := io.WriteString(w.w, lastChunk)
 	if err == nil {
 		w.state = StateDone
+		w.trailerEnd = w.trailers
 	}
 	return n, err
 }
 
 func (w *Writer) WriteTrailers(h header.Headers) error {
-	for name, value := range h {
-		if _, err := fmt.Fprintf(w.w, "%s: %s\r\n", name, value); err != nil {
-			return err
-		}
+	if !w.trailerEnd {
+		return errors.New("trailers must be announced in a Trailer header and follow the last chunk")
 	}
+
 	// End of trailers block
-	_, err := fmt.Fprint(w.w, "\r\n")
+	b := append(AppendHeaders(nil, h), "\r\n"...)
+	_, err := w.w.Write(b)
+	w.trailerEnd = false
 	return err
 }
+
+func appendChunkHeader(b []byte, size int) []byte {
+	b = strconv.AppendInt(b, int64(size), 16)
+	return append(b, "\r\n"...)
+}
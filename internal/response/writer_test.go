@@ -0,0 +1,92 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferedWriter(t *testing.T) {
+	// Test: nothing reaches the connection before Flush
+	var conn bytes.Buffer
+	w := NewBufferedWriter(&conn)
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, conn.Len())
+
+	require.NoError(t, w.Flush())
+	resp, err := http.ReadResponse(bufio.NewReader(&conn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	// Test: Release flushes what is left
+	conn.Reset()
+	w = NewBufferedWriter(&conn)
+	require.NoError(t, w.WriteStatusLine(StatusNotFound))
+	assert.Equal(t, 0, conn.Len())
+	require.NoError(t, w.Release())
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\n", conn.String())
+}
+
+func TestChunkedTrailers(t *testing.T) {
+	var conn bytes.Buffer
+	w := NewBufferedWriter(&conn)
+
+	h := GetDefaultHeaders(0)
+	h.Remove("Content-Length")
+	h.Add("Transfer-Encoding", "chunked")
+	h.Add("Trailer", "X-Checksum")
+
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteChunkedBody(bytes.Repeat([]byte("a"), 26))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+
+	trailers := header.NewHeaders()
+	trailers.Add("X-Checksum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+	require.NoError(t, w.Release())
+
+	// Test: chunk size is hex and trailers follow the last chunk
+	assert.Contains(t, conn.String(), "\r\n\r\n1a\r\n")
+	assert.True(t, bytes.HasSuffix(conn.Bytes(), []byte("0\r\nX-Checksum: abc\r\n\r\n")))
+
+	resp, err := http.ReadResponse(bufio.NewReader(&conn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Len(t, body, 26)
+	assert.Equal(t, "abc", resp.Trailer.Get("X-Checksum"))
+
+	// Test: Finish closes a trailer section the handler left open
+	conn.Reset()
+	w = NewWriter(&conn)
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, bytes.HasSuffix(conn.Bytes(), []byte("\r\n\r\n0\r\n\r\n")))
+
+	// Test: trailers that were not announced are rejected
+	conn.Reset()
+	w = NewWriter(&conn)
+	h.Remove("Trailer")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	assert.Error(t, w.WriteTrailers(trailers))
+}
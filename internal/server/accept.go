@@ -0,0 +1,119 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+// WithAcceptErrorHook reports failed Accept calls to fn instead of the
+// log. retryIn is the backoff before the next attempt, or 0 when the
+// listener was closed and the server has stopped accepting on it.
+func WithAcceptErrorHook(fn func(err error, retryIn time.Duration)) Option {
+	return func(s *Server) {
+		s.acceptHook = fn
+	}
+}
+
+// WithShedIdleConns closes up to n idle keep-alive connections whenever
+// Accept fails for lack of file descriptors, so new clients can be
+// served. n <= 0 closes all of them.
+func WithShedIdleConns(n int) Option {
+	return func(s *Server) {
+		s.shedding = true
+		s.shedIdle = n
+	}
+}
+
+// acceptFailed handles an Accept error. Only a closed listener stops the
+// accept loop, which is reported by returning false. Anything else, from
+// running out of descriptors to a network going down, is retried after
+// an exponential backoff kept in retryIn.
+func (s *Server) acceptFailed(err error, retryIn *time.Duration) bool {
+	if errors.Is(err, net.ErrClosed) {
+		s.reportAcceptError(err, 0)
+		return false
+	}
+
+	if *retryIn == 0 {
+		*retryIn = minAcceptDelay
+	} else {
+		*retryIn = min(2**retryIn, maxAcceptDelay)
+	}
+	s.reportAcceptError(err, *retryIn)
+
+	if s.shedding && (errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)) {
+		if n := s.closeIdleConns(s.shedIdle); n > 0 {
+			log.Printf("Out of file descriptors, closed %d idle connections\n", n)
+		}
+	}
+
+	select {
+	case <-time.After(*retryIn):
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func (s *Server) reportAcceptError(err error, retryIn time.Duration) {
+	if s.acceptHook != nil {
+		s.acceptHook(err, retryIn)
+		return
+	}
+
+	if retryIn == 0 {
+		log.Printf("Accept error, no longer accepting connections: %v\n", err)
+		return
+	}
+	log.Printf("Accept error, retrying in %v: %v\n", retryIn, err)
+}
+
+// closeIdleConns closes up to n connections that wait for another
+// request, n <= 0 closes all. It returns how many it closed.
+func (s *Server) closeIdleConns(n int) int {
+	s.conns.mu.Lock()
+	var idle []*trackedConn
+	for c := range s.conns.all {
+		if n > 0 && len(idle) == n {
+			break
+		}
+		if c.idle.Load() {
+			idle = append(idle, c)
+		}
+	}
+	s.conns.mu.Unlock()
+
+	for _, c := range idle {
+		c.Close()
+	}
+	return len(idle)
+}
+
+func (s *Server) closeAllConns() {
+	s.conns.mu.Lock()
+	conns := make([]*trackedConn, 0, len(s.conns.all))
+	for c := range s.conns.all {
+		conns = append(conns, c)
+	}
+	s.conns.mu.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// setIdle marks a connection as waiting for another request, which lets
+// closeIdleConns pick it.
+func setIdle(conn net.Conn, idle bool) {
+	if c, ok := conn.(*trackedConn); ok {
+		c.idle.Store(idle)
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// faultyListener returns injected errors from Accept before real
+// connections.
+type faultyListener struct {
+	net.Listener
+	errs     chan error
+	accepted chan net.Conn
+}
+
+func newFaultyListener(t *testing.T) *faultyListener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	fl := &faultyListener{Listener: l, errs: make(chan error, 10), accepted: make(chan net.Conn)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				close(fl.accepted)
+				return
+			}
+			fl.accepted <- conn
+		}
+	}()
+	return fl
+}
+
+func (l *faultyListener) Accept() (net.Conn, error) {
+	select {
+	case err := <-l.errs:
+		return nil, err
+	default:
+	}
+
+	select {
+	case err := <-l.errs:
+		return nil, err
+	case conn, ok := <-l.accepted:
+		if !ok {
+			return nil, net.ErrClosed
+		}
+		return conn, nil
+	}
+}
+
+type acceptReport struct {
+	err     error
+	retryIn time.Duration
+}
+
+func TestAcceptBackoff(t *testing.T) {
+	l := newFaultyListener(t)
+	for range 3 {
+		l.errs <- &net.OpError{Op: "accept", Net: "tcp", Err: syscall.EMFILE}
+	}
+
+	var mu sync.Mutex
+	var reports []acceptReport
+	srv, err := ServeListeners([]net.Listener{l}, hello, WithAcceptErrorHook(func(err error, retryIn time.Duration) {
+		mu.Lock()
+		reports = append(reports, acceptReport{err, retryIn})
+		mu.Unlock()
+	}))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Test: temporary errors are retried with a doubling delay
+	conn, br := dial(t, l.Addr().String())
+	_, body := get(t, conn, br, "/")
+	assert.Equal(t, "hello /", body)
+
+	mu.Lock()
+	require.Len(t, reports, 3)
+	assert.Equal(t, []time.Duration{5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond},
+		[]time.Duration{reports[0].retryIn, reports[1].retryIn, reports[2].retryIn})
+	assert.ErrorIs(t, reports[0].err, syscall.EMFILE)
+	mu.Unlock()
+
+	// Test: unknown errors are retried as well
+	l.errs <- &net.OpError{Op: "accept", Net: "tcp", Err: syscall.EPROTO}
+	l.errs <- errors.New("listener broke")
+	conn, br = dial(t, l.Addr().String())
+	_, body = get(t, conn, br, "/again")
+	assert.Equal(t, "hello /again", body)
+
+	mu.Lock()
+	require.Len(t, reports, 5)
+	assert.Equal(t, 5*time.Millisecond, reports[3].retryIn)
+	assert.Equal(t, 10*time.Millisecond, reports[4].retryIn)
+	mu.Unlock()
+
+	// Test: a closed listener stops the accept loop
+	l.errs <- net.ErrClosed
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reports) == 6 && reports[5].retryIn == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func testShedIdleConns(t *testing.T, opts ...Option) {
+	l := newFaultyListener(t)
+	srv, err := ServeListeners([]net.Listener{l}, hello, append(opts, WithShedIdleConns(0), WithAcceptErrorHook(func(error, time.Duration) {}))...)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	idle, idleBr := dial(t, l.Addr().String())
+	get(t, idle, idleBr, "/")
+
+	// Test: running out of descriptors closes idle keep-alive connections
+	l.errs <- &net.OpError{Op: "accept", Net: "tcp", Err: syscall.EMFILE}
+
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = idleBr.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestShedIdleConns(t *testing.T) {
+	testShedIdleConns(t)
+}
+
+func testShedPartialRequest(t *testing.T, opts ...Option) {
+	srv, addr := startServerWith(t, func(w io.Writer, r *request.Request) *HandlerError {
+		w.Write([]byte("got " + string(r.Body)))
+		return nil
+	}, opts...)
+
+	conn, br := dial(t, addr)
+	_, body := get(t, conn, br, "/")
+	assert.Equal(t, "got ", body)
+
+	// Test: shedding spares a keep-alive connection whose next request
+	// has started, in the header and in the body
+	for _, part := range []string{"POST /upload HTTP/1.1\r\nHost: loc", "alhost\r\nContent-Length: 10\r\n\r\nhello"} {
+		_, err := io.WriteString(conn, part)
+		require.NoError(t, err)
+		time.Sleep(50 * time.Millisecond)
+		assert.Zero(t, srv.closeIdleConns(0))
+	}
+
+	_, err := io.WriteString(conn, "world")
+	require.NoError(t, err)
+	_, body = readResponse(t, br)
+	assert.Equal(t, "got helloworld", body)
+}
+
+func TestShedPartialRequest(t *testing.T) {
+	testShedPartialRequest(t)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var errCertificateRevoked = errors.New("client certificate has been revoked")
+
+func loadClientCAs(files []string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", name)
+		}
+	}
+	return pool, nil
+}
+
+func loadCRLs(files []string) ([]*x509.RevocationList, error) {
+	var crls []*x509.RevocationList
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+
+		ders := [][]byte{}
+		for rest := data; ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type == "X509 CRL" {
+				ders = append(ders, block.Bytes)
+			}
+		}
+		if len(ders) == 0 {
+			ders = append(ders, data) // not PEM, try DER
+		}
+
+		for _, der := range ders {
+			crl, err := x509.ParseRevocationList(der)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse CRL %s: %v", name, err)
+			}
+			crls = append(crls, crl)
+		}
+	}
+	return crls, nil
+}
+
+// checkRevocation rejects connections whose verified client chain holds
+// a certificate revoked by a CRL its issuer signed.
+func checkRevocation(crls []*x509.RevocationList) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		for _, chain := range cs.VerifiedChains {
+			for i := 0; i+1 < len(chain); i++ {
+				if revoked(crls, chain[i], chain[i+1]) {
+					return errCertificateRevoked
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func revoked(crls []*x509.RevocationList, cert, issuer *x509.Certificate) bool {
+	for _, crl := range crls {
+		if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) || crl.CheckSignatureFrom(issuer) != nil {
+			continue
+		}
+
+		for _, entry := range crl.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	file := filepath.Join(dir, name+".crt")
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+// issueClient signs a client certificate with the given serial and URI SAN.
+func (ca *testCA) issueClient(t *testing.T, serial int64, commonName, uri string) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(uri)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		URIs:         []*url.URL{parsed},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (ca *testCA) writeCRL(t *testing.T, dir string, serials ...int64) string {
+	t.Helper()
+
+	var entries []x509.RevocationListEntry
+	for _, serial := range serials {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(1),
+		ThisUpdate:                time.Now().Add(-time.Minute),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}, ca.cert, ca.key)
+	require.NoError(t, err)
+
+	file := filepath.Join(dir, "revoked.crl")
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o600))
+	return file
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverFiles, _ := writeCert(t, dir, "server", "example.test")
+	ca := newTestCA(t, dir, "clients")
+	other := newTestCA(t, dir, "other")
+
+	var identity *request.ClientIdentity
+	_, addr := startServerWith(t, func(w io.Writer, r *request.Request) *HandlerError {
+		identity = r.ClientIdentity()
+		return hello(w, r)
+	}, WithTLS(TLSConfig{
+		Certificates:  []CertFile{serverFiles},
+		ClientCAFiles: []string{ca.file},
+		CRLFiles:      []string{ca.writeCRL(t, dir, 2)},
+	}))
+
+	request := func(certs ...tls.Certificate) error {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{
+			InsecureSkipVerify: true,
+			// send the certificate even if the server does not list its CA
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				if len(certs) == 0 {
+					return &tls.Certificate{}, nil
+				}
+				return &certs[0], nil
+			},
+		})
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: example.test\r\nConnection: close\r\n\r\n"); err != nil {
+			return err
+		}
+		// with TLS 1.3 a rejected client only learns about it here
+		resp, err := io.ReadAll(conn)
+		if err == nil && !strings.Contains(string(resp), "hello /") {
+			err = errors.New("no response")
+		}
+		return err
+	}
+
+	// Test: a verified client certificate becomes the request identity
+	require.NoError(t, request(ca.issueClient(t, 1, "billing", "spiffe://example.org/billing")))
+	require.NotNil(t, identity)
+	assert.Equal(t, "billing", identity.Subject.CommonName)
+	assert.Equal(t, "spiffe://example.org/billing", identity.SPIFFEID)
+
+	// Test: clients without a certificate are let through without identity
+	require.NoError(t, request())
+	assert.Nil(t, identity)
+
+	// Test: revoked and foreign certificates fail the handshake
+	assert.Error(t, request(ca.issueClient(t, 2, "revoked", "spiffe://example.org/revoked")))
+	assert.Error(t, request(other.issueClient(t, 1, "intruder", "spiffe://evil.org/intruder")))
+}
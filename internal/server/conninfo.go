@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net"
+
+	"github.com/harry713j/http-server/internal/request"
+)
+
+// connRequest sets the connection metadata on req and counts it as the
+// next request on conn.
+func connRequest(conn net.Conn, req *request.Request) {
+	tc, ok := conn.(*trackedConn)
+	if !ok {
+		req.Conn = &request.ConnInfo{RemoteAddr: conn.RemoteAddr(), LocalAddr: conn.LocalAddr()}
+		req.TLS = connectionState(conn)
+		req.Seq = 1
+		return
+	}
+
+	// the addresses and TLS state are final once the PROXY header is read
+	// and the handshake is done, which is before the first request
+	tc.infoOnce.Do(func() {
+		tc.info.RemoteAddr = conn.RemoteAddr()
+		tc.info.LocalAddr = conn.LocalAddr()
+		tc.tlsState = connectionState(conn)
+	})
+
+	tc.requests++
+	req.Conn = &tc.info
+	req.TLS = tc.tlsState
+	req.Seq = tc.requests
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/harry713j/http-server/internal/proxyproto"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func connInfo(w io.Writer, r *request.Request) *HandlerError {
+	c := r.Conn
+	fmt.Fprintf(w, "%d %d %s %s %t", c.ID, r.Seq, c.RemoteAddr, c.LocalAddr, time.Since(c.AcceptedAt) < time.Minute)
+	return nil
+}
+
+func TestConnInfo(t *testing.T) {
+	_, addr := startServerWith(t, connInfo)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	// Test: requests on a connection share its metadata and are numbered
+	_, first := get(t, conn, br, "/")
+	_, second := get(t, conn, br, "/")
+
+	var id, seq int
+	var remote, local string
+	var accepted bool
+	_, err = fmt.Sscan(first, &id, &seq, &remote, &local, &accepted)
+	require.NoError(t, err)
+	assert.Equal(t, 1, seq)
+	assert.Equal(t, conn.LocalAddr().String(), remote)
+	assert.Equal(t, conn.RemoteAddr().String(), local)
+	assert.True(t, accepted)
+	assert.Equal(t, fmt.Sprintf("%d 2 %s %s true", id, remote, local), second)
+
+	// Test: another connection gets a new ID
+	other, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer other.Close()
+	_, body := get(t, other, bufio.NewReader(other), "/")
+	assert.Equal(t, fmt.Sprintf("%d 1 %s %s true", id+1, other.LocalAddr(), other.RemoteAddr()), body)
+}
+
+// Test: the addresses come from the PROXY header when there is one
+func TestConnInfoProxyProtocol(t *testing.T) {
+	_, addr := startServerWith(t, connInfo, WithProxyProtocol(proxyproto.Options{}))
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = io.WriteString(conn, "PROXY TCP4 192.0.2.1 198.51.100.7 51234 443\r\n")
+	require.NoError(t, err)
+	_, body := get(t, conn, bufio.NewReader(conn), "/")
+	assert.Contains(t, body, " 1 192.0.2.1:51234 198.51.100.7:443 true")
+}
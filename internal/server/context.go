@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/harry713j/http-server/internal/netutil"
+	"github.com/harry713j/http-server/internal/request"
+)
+
+// Causes of a cancelled request context, see context.Cause.
+var (
+	ErrClientGone     = errors.New("client closed the connection")
+	ErrHandlerTimeout = errors.New("handler timed out")
+	ErrServerClosed   = errors.New("server closed")
+)
+
+// WithHandlerTimeout cancels the request context after d. The handler is
+// not interrupted, it has to watch the context and return.
+func WithHandlerTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.handlerTimeout = d
+	}
+}
+
+// requestContext derives the context of a request from the server's, and
+// arranges for out to cancel it when a write fails.
+func (s *Server) requestContext(out *connWriter) (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(s.ctx)
+	if s.handlerTimeout > 0 {
+		var stopTimer context.CancelFunc
+		ctx, stopTimer = context.WithTimeoutCause(ctx, s.handlerTimeout, ErrHandlerTimeout)
+
+		cancelCause := cancel
+		cancel = func(cause error) {
+			cancelCause(cause)
+			stopTimer()
+		}
+	}
+
+	out.cancel = cancel
+	return ctx, cancel
+}
+
+// watchConn reads ahead on the connection while the handler runs, so a
+// client that goes away cancels the request. Bytes of a pipelined request
+// are kept by reader. stop ends the watch and reports whether the
+// connection is still open, it may be called more than once.
+func watchConn(conn net.Conn, reader *request.Reader, cancel context.CancelCauseFunc) (stop func() bool) {
+	var stopping, closed atomic.Bool
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		// one read is enough: data means the client is still there
+		if _, err := reader.ReadAhead(); err != nil && !stopping.Load() {
+			closed.Store(true)
+			cancel(ErrClientGone)
+		}
+	}()
+
+	var once sync.Once
+	return func() bool {
+		once.Do(func() {
+			stopping.Store(true)
+			conn.SetReadDeadline(time.Unix(1, 0)) // interrupt the read
+			<-done
+			conn.SetReadDeadline(time.Time{})
+		})
+		return !closed.Load()
+	}
+}
+
+// connWriter cancels the request context when writing to the connection
+// fails.
+type connWriter struct {
+	net.Conn
+	cancel context.CancelCauseFunc
+}
+
+func (w *connWriter) Write(p []byte) (int, error) {
+	n, err := w.Conn.Write(p)
+	if err != nil && w.cancel != nil {
+		w.cancel(err)
+	}
+	return n, err
+}
+
+// ReadFrom cancels the request context on failure, like Write.
+func (w *connWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := netutil.ReadFrom(w.Conn, r)
+	if err != nil && w.cancel != nil {
+		w.cancel(err)
+	}
+	return n, err
+}
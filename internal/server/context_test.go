@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForCancel blocks until the request context ends and reports the
+// cause on causes.
+func waitForCancel(causes chan<- error) Handler {
+	return func(w io.Writer, r *request.Request) *HandlerError {
+		select {
+		case <-r.Context().Done():
+			causes <- context.Cause(r.Context())
+		case <-time.After(5 * time.Second):
+			causes <- nil
+		}
+		w.Write([]byte("done"))
+		return nil
+	}
+}
+
+// Test: a client that disconnects cancels its request
+func TestContextClientGone(t *testing.T) {
+	causes := make(chan error, 1)
+	_, addr := startServerWith(t, waitForCancel(causes))
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+
+	assert.ErrorIs(t, <-causes, ErrClientGone)
+}
+
+// Test: the handler timeout cancels the context, the response still goes out
+func TestContextTimeout(t *testing.T) {
+	causes := make(chan error, 1)
+	_, addr := startServerWith(t, waitForCancel(causes), WithHandlerTimeout(50*time.Millisecond))
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, body := get(t, conn, bufio.NewReader(conn), "/")
+	assert.Equal(t, "done", body)
+	assert.ErrorIs(t, <-causes, ErrHandlerTimeout)
+}
+
+// Test: closing the server cancels requests in flight
+func TestContextServerClosed(t *testing.T) {
+	causes := make(chan error, 1)
+	srv, addr := startServerWith(t, waitForCancel(causes))
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	srv.Close()
+	assert.ErrorIs(t, <-causes, ErrServerClosed)
+}
+
+// Test: a request pipelined while the handler runs is served next, and
+// does not cancel the first one
+func TestContextPipelinedDuringHandler(t *testing.T) {
+	type seenKey struct{}
+
+	handler := func(w io.Writer, r *request.Request) *HandlerError {
+		// Test: values set by middleware reach the handler
+		assert.Equal(t, true, r.Context().Value(seenKey{}))
+
+		if r.RequestLine.RequestTarget == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if r.Context().Err() != nil {
+			w.Write([]byte("cancelled"))
+			return nil
+		}
+		w.Write([]byte("hello " + r.RequestLine.RequestTarget))
+		return nil
+	}
+	middleware := func(w io.Writer, r *request.Request) *HandlerError {
+		r.SetContext(context.WithValue(r.Context(), seenKey{}, true))
+		return handler(w, r)
+	}
+	_, addr := startServerWith(t, middleware)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	_, err = io.WriteString(conn, "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	time.Sleep(30 * time.Millisecond)
+	_, err = io.WriteString(conn, "GET /next HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+
+	resp, body := readResponse(t, br)
+	assert.Equal(t, "hello /slow", body)
+	assert.False(t, resp.Close)
+	_, body = readResponse(t, br)
+	assert.Equal(t, "hello /next", body)
+}
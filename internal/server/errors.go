@@ -0,0 +1,121 @@
+package server
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+)
+
+// ErrorRenderer writes the response for a HandlerError. r is nil when the
+// request itself could not be parsed.
+type ErrorRenderer func(w *response.Writer, r *request.Request, hErr *HandlerError) error
+
+// ErrorPageData is passed to custom HTML error page templates.
+type ErrorPageData struct {
+	StatusCode response.StatusCode
+	Title      string
+	Message    string
+}
+
+var defaultErrorPage = template.Must(template.New("error").Parse(`<html>
+	<head>
+		<title>{{.StatusCode}} {{.Title}}</title>
+	</head>
+	<body>
+		<h1>{{.Title}}</h1>
+		<p>{{.Message}}</p>
+	</body>
+</html>
+`))
+
+// DefaultErrorRenderer renders HTML, problem+json or plain text depending
+// on what the request's Accept header asks for.
+func DefaultErrorRenderer(w *response.Writer, r *request.Request, hErr *HandlerError) error {
+	return NewErrorRenderer(nil)(w, r, hErr)
+}
+
+// NewErrorRenderer is like DefaultErrorRenderer but renders HTML errors
+// with the template registered for the status code. Status code 0 is used
+// as the fallback page.
+func NewErrorRenderer(pages map[response.StatusCode]*template.Template) ErrorRenderer {
+	return func(w *response.Writer, r *request.Request, hErr *HandlerError) error {
+		switch errorMediaType(w, r) {
+		case "text/html":
+			page, ok := pages[hErr.StatusCode]
+			if !ok {
+				if page, ok = pages[0]; !ok {
+					page = defaultErrorPage
+				}
+			}
+			return renderHTML(w, page, hErr)
+		case "application/problem+json", "application/json":
+			addErrorHeaders(w, hErr)
+			return w.WriteProblem(hErr.Problem())
+		default:
+			return renderText(w, hErr)
+		}
+	}
+}
+
+// errorMediaType negotiates between text, HTML and problem+json, falling
+// back to text when nothing offered is acceptable.
+func errorMediaType(w *response.Writer, r *request.Request) string {
+	if r == nil {
+		return "text/plain"
+	}
+
+	return response.Negotiate(w, r.Headers, "Accept",
+		"text/plain", "text/html", "application/problem+json", "application/json")
+}
+
+func addErrorHeaders(w *response.Writer, hErr *HandlerError) {
+	if len(hErr.Headers) == 0 {
+		return
+	}
+
+	w.BeforeWriteHeaders(func(h header.Headers) {
+		for key, value := range hErr.Headers {
+			h.Add(key, value)
+		}
+	})
+}
+
+func renderText(w *response.Writer, hErr *HandlerError) error {
+	return writeError(w, hErr, "text/plain", []byte(hErr.Message))
+}
+
+func renderHTML(w *response.Writer, page *template.Template, hErr *HandlerError) error {
+	var body bytes.Buffer
+	data := ErrorPageData{
+		StatusCode: hErr.StatusCode,
+		Title:      response.StatusText(hErr.StatusCode),
+		Message:    hErr.Message,
+	}
+
+	if err := page.Execute(&body, data); err != nil {
+		return err
+	}
+
+	return writeError(w, hErr, "text/html", body.Bytes())
+}
+
+func writeError(w *response.Writer, hErr *HandlerError, contentType string, body []byte) error {
+	addErrorHeaders(w, hErr)
+
+	if err := w.WriteStatusLine(hErr.StatusCode); err != nil {
+		return err
+	}
+
+	headers := response.GetDefaultHeaders(len(body))
+	headers.Add("Content-Type", contentType)
+
+	if err := w.WriteHeaders(headers); err != nil {
+		return err
+	}
+
+	_, err := w.WriteBody(body)
+	return err
+}
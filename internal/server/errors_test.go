@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// render renders hErr for a request with the given Accept header, nil
+// headers stand for a request that could not be parsed.
+func render(t *testing.T, renderer ErrorRenderer, headers header.Headers, hErr *HandlerError) (*http.Response, string) {
+	t.Helper()
+
+	var r *request.Request
+	if headers != nil {
+		r = &request.Request{Headers: headers}
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, renderer(response.NewWriter(&out), r, hErr))
+	return readResponse(t, bufio.NewReader(&out))
+}
+
+func TestDefaultErrorRenderer(t *testing.T) {
+	hErr := &HandlerError{StatusCode: response.StatusNotFound, Message: "no such <thing>"}
+
+	// Test: HTML for browsers, with the message escaped
+	resp, body := render(t, DefaultErrorRenderer, header.Headers{"accept": "text/html,application/xhtml+xml,*/*;q=0.8"}, hErr)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "text/html", resp.Header.Get("Content-Type"))
+	assert.Contains(t, body, "<h1>Not Found</h1>")
+	assert.Contains(t, body, "no such &lt;thing&gt;")
+	assert.Equal(t, "Accept", resp.Header.Get("Vary"))
+
+	// Test: problem+json for API clients
+	resp, body = render(t, DefaultErrorRenderer, header.Headers{"accept": "application/json"}, hErr)
+	assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+	var problem map[string]any
+	require.NoError(t, json.Unmarshal([]byte(body), &problem))
+	assert.Equal(t, "Not Found", problem["title"])
+	assert.Equal(t, float64(404), problem["status"])
+	assert.Equal(t, "no such <thing>", problem["detail"])
+
+	// Test: text without Accept, for unparsable requests and when nothing
+	// offered is acceptable
+	for _, headers := range []header.Headers{{}, nil, {"accept": "image/png"}} {
+		resp, body = render(t, DefaultErrorRenderer, headers, hErr)
+		assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "no such <thing>", body)
+	}
+}
+
+func TestNewErrorRenderer(t *testing.T) {
+	renderer := NewErrorRenderer(map[response.StatusCode]*template.Template{
+		response.StatusNotFound: template.Must(template.New("404").Parse(`lost: {{.Message}}`)),
+		0:                       template.Must(template.New("fallback").Parse(`{{.StatusCode}} {{.Title}}`)),
+	})
+	html := header.Headers{"accept": "text/html"}
+
+	// Test: the page registered for the status code is used
+	_, body := render(t, renderer, html, &HandlerError{StatusCode: response.StatusNotFound, Message: "gone"})
+	assert.Equal(t, "lost: gone", body)
+
+	// Test: other status codes fall back to the page for 0
+	_, body = render(t, renderer, html, &HandlerError{StatusCode: response.StatusForbidden, Message: "no"})
+	assert.Equal(t, "403 Forbidden", body)
+
+	// Test: non-HTML clients are not affected by the pages
+	_, body = render(t, renderer, header.Headers{}, &HandlerError{StatusCode: response.StatusNotFound, Message: "gone"})
+	assert.Equal(t, "gone", body)
+}
+
+// Test: HandlerError.Headers reach the response in every format
+func TestErrorHeaders(t *testing.T) {
+	hErr := &HandlerError{
+		StatusCode: response.StatusTooManyRequests,
+		Message:    "slow down",
+		Headers:    header.Headers{"Retry-After": "30"},
+	}
+
+	for _, accept := range []string{"text/html", "application/problem+json", "text/plain"} {
+		resp, _ := render(t, DefaultErrorRenderer, header.Headers{"accept": accept}, hErr)
+		assert.Equal(t, "30", resp.Header.Get("Retry-After"), accept)
+	}
+}
+
+// lockedBuffer collects log output written by server goroutines.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Test: the Cause of an error is logged but never sent to the client
+func TestErrorCause(t *testing.T) {
+	var logs lockedBuffer
+	prev := log.Writer()
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(prev) })
+
+	_, addr := startServerWith(t, func(w io.Writer, r *request.Request) *HandlerError {
+		return &HandlerError{
+			StatusCode: response.StatusInternalServerError,
+			Message:    "something went wrong",
+			Cause:      errors.New("dial tcp 10.0.0.5:5432: connection refused"),
+		}
+	})
+
+	conn, br := dial(t, addr)
+	resp, body := get(t, conn, br, "/")
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "something went wrong", body)
+	assert.NotContains(t, body, "10.0.0.5")
+	assert.Contains(t, logs.String(), "dial tcp 10.0.0.5:5432: connection refused")
+}
@@ -0,0 +1,293 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// syscall.EPOLLET is a negative int constant
+	epollET = 1 << 31
+
+	// peekSize bounds how much of a request header the loop inspects. A
+	// connection whose header does not end within it goes to a worker
+	// anyway, whose Reader answers 431 past RequestLimits.MaxHeaderBytes.
+	peekSize = 8 * 1024
+
+	// maxSweepInterval bounds how late the loop closes a connection that
+	// ran out of time, see Timeouts
+	maxSweepInterval = time.Second
+)
+
+var headerEnd = []byte("\r\n\r\n")
+
+// eventLoop waits for readable connections in a single goroutine. It
+// only peeks at the socket, so until a request header is complete the
+// bytes stay in the kernel and the connection owns no buffer.
+type eventLoop struct {
+	srv     *Server
+	epfd    int
+	wake    [2]int // pipe that interrupts EpollWait on close
+	mu      sync.Mutex
+	stopped bool              // the descriptors are closed
+	conns   map[int]*loopConn // connections waiting in epoll by fd
+	peek    []byte            // only touched by the loop goroutine
+	sweep   time.Duration     // how often timed out connections are closed, 0 for never
+}
+
+type loopConn struct {
+	conn     net.Conn
+	fd       int
+	deadline time.Time // the connection is closed after it, zero for never
+	reading  bool      // part of a request header arrived
+}
+
+func newEventLoop(s *Server) (*eventLoop, error) {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create epoll instance: %v", err)
+	}
+
+	l := &eventLoop{srv: s, epfd: epfd, conns: map[int]*loopConn{}, peek: make([]byte, peekSize)}
+
+	// sweep often enough to close connections at most half a timeout late
+	for _, d := range []time.Duration{s.timeouts.Idle, s.timeouts.Read} {
+		if d > 0 && (l.sweep == 0 || d/2 < l.sweep) {
+			l.sweep = min(d/2, maxSweepInterval)
+		}
+	}
+
+	if err := syscall.Pipe2(l.wake[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		syscall.Close(epfd)
+		return nil, fmt.Errorf("failed to create wake pipe: %v", err)
+	}
+
+	ev := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(l.wake[0])}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, l.wake[0], &ev); err != nil {
+		l.closeFds()
+		return nil, fmt.Errorf("failed to watch wake pipe: %v", err)
+	}
+
+	return l, nil
+}
+
+// add hands a newly accepted connection to the loop.
+func (l *eventLoop) add(conn net.Conn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return errors.New("connection does not expose a file descriptor")
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	lc := &loopConn{conn: conn}
+	if err := raw.Control(func(fd uintptr) { lc.fd = int(fd) }); err != nil {
+		return err
+	}
+
+	return l.watch(lc)
+}
+
+// watch registers lc edge-triggered. If data is already waiting, as with
+// a pipelined request, epoll reports it right away.
+func (l *eventLoop) watch(lc *loopConn) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stopped {
+		return errors.New("event loop is closed")
+	}
+
+	l.conns[lc.fd] = lc
+	lc.reading = false
+	lc.deadline = time.Time{}
+	if idle := l.srv.timeouts.Idle; idle > 0 {
+		lc.deadline = time.Now().Add(idle)
+	}
+
+	ev := syscall.EpollEvent{Events: syscall.EPOLLIN | syscall.EPOLLRDHUP | epollET, Fd: int32(lc.fd)}
+	if err := syscall.EpollCtl(l.epfd, syscall.EPOLL_CTL_ADD, lc.fd, &ev); err != nil {
+		delete(l.conns, lc.fd)
+		return err
+	}
+	return nil
+}
+
+func (l *eventLoop) forget(lc *loopConn) {
+	l.mu.Lock()
+	delete(l.conns, lc.fd)
+	l.mu.Unlock()
+}
+
+func (l *eventLoop) run() {
+	events := make([]syscall.EpollEvent, 256)
+
+	timeout := -1
+	if l.sweep > 0 {
+		timeout = max(int(l.sweep/time.Millisecond), 1)
+	}
+	lastSweep := time.Now()
+
+	for {
+		n, err := syscall.EpollWait(l.epfd, events, timeout)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			log.Printf("Event loop error: %v\n", err)
+			l.shutdown()
+			return
+		}
+
+		for _, ev := range events[:n] {
+			if int(ev.Fd) == l.wake[0] {
+				l.shutdown()
+				return
+			}
+			l.ready(int(ev.Fd), ev.Events)
+		}
+
+		if l.sweep > 0 && time.Since(lastSweep) >= l.sweep {
+			lastSweep = time.Now()
+			l.closeExpired(lastSweep)
+		}
+	}
+}
+
+// closeExpired closes the connections whose idle or read timeout passed.
+func (l *eventLoop) closeExpired(now time.Time) {
+	var expired []*loopConn
+	l.mu.Lock()
+	for fd, lc := range l.conns {
+		if !lc.deadline.IsZero() && now.After(lc.deadline) {
+			delete(l.conns, fd)
+			expired = append(expired, lc)
+		}
+	}
+	l.mu.Unlock()
+
+	for _, lc := range expired {
+		lc.conn.Close()
+	}
+}
+
+// ready decides what to do with a connection epoll reported.
+func (l *eventLoop) ready(fd int, events uint32) {
+	l.mu.Lock()
+	lc := l.conns[fd]
+	l.mu.Unlock()
+
+	if lc == nil {
+		return
+	}
+
+	if events&(syscall.EPOLLERR|syscall.EPOLLHUP) != 0 {
+		l.drop(lc)
+		return
+	}
+
+	n, _, err := syscall.Recvfrom(fd, l.peek, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+	switch {
+	case err == syscall.EAGAIN:
+		return
+	case err != nil || n == 0:
+		l.drop(lc) // closed by the client
+	case bytes.Contains(l.peek[:n], headerEnd) || n == len(l.peek):
+		l.dispatch(lc)
+	case events&syscall.EPOLLRDHUP != 0:
+		l.drop(lc) // half a header and nothing more will come
+	default:
+		// wait for the rest of the header, the next edge wakes us, but
+		// no longer than the read timeout
+		setIdle(lc.conn, false)
+		l.mu.Lock()
+		if read := l.srv.timeouts.Read; read > 0 && !lc.reading {
+			lc.reading = true
+			lc.deadline = time.Now().Add(read)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// dispatch moves lc out of epoll and serves it from a worker goroutine.
+func (l *eventLoop) dispatch(lc *loopConn) {
+	l.forget(lc)
+	if err := syscall.EpollCtl(l.epfd, syscall.EPOLL_CTL_DEL, lc.fd, nil); err != nil {
+		log.Printf("Event loop error: %v\n", err)
+		lc.conn.Close()
+		return
+	}
+
+	go l.serve(lc)
+}
+
+// serve handles the requests that are ready and then gives an idle
+// keep-alive connection back to the loop, together with its buffer.
+func (l *eventLoop) serve(lc *loopConn) {
+	// the loop only dispatches connections whose request has started
+	setIdle(lc.conn, false)
+
+	reader := l.srv.newReader(lc.conn)
+	defer reader.Release()
+
+	for l.srv.serveRequest(lc.conn, reader) {
+		if reader.Buffered() > 0 {
+			continue // pipelined request already read
+		}
+
+		if l.srv.closed.Load() {
+			break
+		}
+
+		setIdle(lc.conn, true)
+		if err := l.watch(lc); err != nil {
+			break
+		}
+		return
+	}
+
+	lc.conn.Close()
+}
+
+func (l *eventLoop) drop(lc *loopConn) {
+	l.forget(lc)
+	// closing the descriptor also removes it from epoll
+	lc.conn.Close()
+}
+
+// close stops the loop, it closes the idle connections on its way out.
+func (l *eventLoop) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.stopped {
+		syscall.Write(l.wake[1], []byte{0})
+	}
+}
+
+func (l *eventLoop) shutdown() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stopped = true
+	for _, lc := range l.conns {
+		lc.conn.Close()
+	}
+	l.conns = map[int]*loopConn{}
+	l.closeFds()
+}
+
+func (l *eventLoop) closeFds() {
+	syscall.Close(l.epfd)
+	syscall.Close(l.wake[0])
+	syscall.Close(l.wake[1])
+}
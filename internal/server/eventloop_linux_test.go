@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLoopKeepAlive(t *testing.T) {
+	testKeepAlive(t, WithEventLoop())
+}
+
+func TestEventLoopCloseIdleConns(t *testing.T) {
+	testCloseIdleConns(t, WithEventLoop())
+}
+
+func TestEventLoopShedIdleConns(t *testing.T) {
+	testShedIdleConns(t, WithEventLoop())
+}
+
+func TestEventLoopShedPartialRequest(t *testing.T) {
+	testShedPartialRequest(t, WithEventLoop())
+}
+
+func TestEventLoopTimeouts(t *testing.T) {
+	testTimeouts(t, WithEventLoop())
+}
+
+func TestEventLoopPartialHeader(t *testing.T) {
+	addr := startServer(t, WithEventLoop())
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Test: a header arriving in pieces is only served once complete
+	_, err = io.WriteString(conn, "GET /slow HTTP/1.1\r\nHost: loc")
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	_, err = io.WriteString(conn, "alhost\r\n\r\n")
+	require.NoError(t, err)
+
+	_, body := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, "hello /slow", body)
+}
+
+// TestIdleConnectionMemory is the load test for the event loop: it opens
+// many keep-alive connections, serves one request on each and compares
+// the memory they hold while idle in both modes. The client side of the
+// connections lives in the same process and is counted in both. Set
+// IDLE_CONNS to change the number of connections.
+func TestIdleConnectionMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test")
+	}
+
+	conns := 2000
+	if n, err := strconv.Atoi(os.Getenv("IDLE_CONNS")); err == nil {
+		conns = n
+	}
+
+	perConn := func(opts ...Option) float64 {
+		addr := startServer(t, opts...)
+		before := inUse()
+
+		clients := make([]net.Conn, 0, conns)
+		defer func() {
+			for _, c := range clients {
+				c.Close()
+			}
+			// let the server notice before the next mode is measured
+			time.Sleep(200 * time.Millisecond)
+		}()
+
+		for range conns {
+			c, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			clients = append(clients, c)
+
+			_, err = io.WriteString(c, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+			require.NoError(t, err)
+			resp, _ := readResponse(t, bufio.NewReader(c))
+			require.False(t, resp.Close)
+		}
+
+		// let the server goroutines settle into their idle state
+		time.Sleep(100 * time.Millisecond)
+		return float64(inUse()-before) / float64(conns)
+	}
+
+	// the event loop goes first, memory released while the goroutine
+	// mode winds down would otherwise be credited to it
+	loop := perConn(WithEventLoop())
+	goroutines := perConn()
+
+	t.Logf("idle connections: %d", conns)
+	t.Logf("goroutine per connection: %.0f bytes/conn", goroutines)
+	t.Logf("event loop:               %.0f bytes/conn", loop)
+
+	assert.Less(t, loop, goroutines)
+}
+
+func inUse() int64 {
+	runtime.GC()
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return int64(m.HeapInuse + m.StackInuse)
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+)
+
+type eventLoop struct{}
+
+func newEventLoop(s *Server) (*eventLoop, error) {
+	return nil, errors.New("event loop mode is only supported on Linux")
+}
+
+func (l *eventLoop) add(conn net.Conn) error {
+	return errors.New("event loop mode is only supported on Linux")
+}
+
+func (l *eventLoop) run() {}
+
+func (l *eventLoop) close() {}
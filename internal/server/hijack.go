@@ -0,0 +1,64 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+)
+
+var (
+	ErrNotHijackable = errors.New("request was not served by a Server")
+	ErrHijacked      = errors.New("connection already hijacked")
+)
+
+// hijackKey holds the request's *hijacker on its context.
+type hijackKey struct{}
+
+// hijacker hands the connection of a request to its handler.
+type hijacker struct {
+	conn      net.Conn
+	reader    *request.Reader
+	w         *response.Writer
+	stopWatch func() bool // nil when nobody reads ahead
+	done      atomic.Bool
+}
+
+// Hijack takes the connection of r over from the server, for protocols
+// like WebSocket or CONNECT tunnels. It flushes what the handler wrote so
+// far, a 101 response for instance, and returns the connection along with
+// the bytes the client sent after the request that were already read.
+// Those come before anything read from conn.
+//
+// From then on the server neither reads, writes nor closes conn, and it
+// no longer counts towards the connection limits. The handler must not
+// use its response writer anymore and has to close conn itself.
+func Hijack(r *request.Request) (conn net.Conn, buffered []byte, err error) {
+	h, ok := r.Context().Value(hijackKey{}).(*hijacker)
+	if !ok {
+		return nil, nil, ErrNotHijackable
+	}
+	if h.done.Swap(true) {
+		return nil, nil, ErrHijacked
+	}
+
+	// nothing may read from the connection behind the caller's back
+	if h.stopWatch != nil {
+		h.stopWatch()
+	}
+
+	if err := h.w.Flush(); err != nil {
+		return nil, nil, err
+	}
+
+	conn = h.conn
+	if tc, ok := conn.(*trackedConn); ok {
+		tc.hijacked.Store(true)
+		tc.once.Do(tc.release)
+		conn = tc.Conn
+	}
+
+	return conn, h.reader.TakeBuffered(), nil
+}
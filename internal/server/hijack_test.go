@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoUpgrade switches to a protocol that echoes every byte until the
+// client closes.
+func echoUpgrade(hijacked chan<- error) Handler {
+	return func(w io.Writer, r *request.Request) *HandlerError {
+		respWriter := response.NewWriter(w)
+		if err := respWriter.WriteStatusLine(response.StatusSwitchingProtocols); err != nil {
+			return &HandlerError{StatusCode: response.StatusInternalServerError, Message: err.Error()}
+		}
+		if err := respWriter.WriteHeaders(header.Headers{"Connection": "Upgrade", "Upgrade": "echo"}); err != nil {
+			return &HandlerError{StatusCode: response.StatusInternalServerError, Message: err.Error()}
+		}
+
+		conn, buffered, err := Hijack(r)
+		if err != nil {
+			hijacked <- err
+			return nil
+		}
+		_, _, err = Hijack(r)
+		hijacked <- err
+
+		go func() {
+			defer conn.Close()
+			conn.Write(buffered)
+			io.Copy(conn, conn)
+		}()
+		return nil
+	}
+}
+
+func TestHijack(t *testing.T) {
+	hijacked := make(chan error, 1)
+	srv, addr := startServerWith(t, echoUpgrade(hijacked))
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	// the first bytes of the new protocol arrive with the request
+	_, err = io.WriteString(conn, "GET /echo HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\nping")
+	require.NoError(t, err)
+
+	// Test: the 101 keeps its Connection: Upgrade
+	line, err := br.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 101 Switching Protocols\r\n", line)
+	var headers []string
+	for {
+		line, err := br.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+		headers = append(headers, line)
+	}
+	assert.Contains(t, headers, "Connection: Upgrade\r\n")
+
+	// Test: a second Hijack fails
+	assert.ErrorIs(t, <-hijacked, ErrHijacked)
+
+	// Test: the buffered bytes are handed over, then the connection is
+	// the handler's
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(br, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	_, err = io.WriteString(conn, "pong")
+	require.NoError(t, err)
+	_, err = io.ReadFull(br, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(buf))
+
+	// Test: hijacked connections are not tracked by the server
+	assert.Equal(t, 0, srv.Stats().OpenConns)
+}
+
+// Test: requests that don't come from a Server can't be hijacked
+func TestHijackNotServed(t *testing.T) {
+	_, _, err := Hijack(&request.Request{})
+	assert.ErrorIs(t, err, ErrNotHijackable)
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/netutil"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+)
+
+// ConnLimits bounds the connections the server holds open at once. Zero
+// values mean no limit.
+type ConnLimits struct {
+	MaxConns int
+	// RejectWhenFull answers connections beyond MaxConns with 503 right
+	// away. By default the server stops accepting instead, and new
+	// connections wait in the listen backlog until a slot frees up.
+	RejectWhenFull bool
+	// MaxConnsPerIP answers a client's connections beyond the limit with
+	// 429. With WithProxyProtocol the client is the source the PROXY
+	// header reports, not the load balancer.
+	MaxConnsPerIP int
+}
+
+// WithConnLimits limits concurrent connections, see ConnLimits.
+func WithConnLimits(limits ConnLimits) Option {
+	return func(s *Server) {
+		s.limits = limits
+		if limits.MaxConns > 0 && !limits.RejectWhenFull {
+			s.connSlots = make(chan struct{}, limits.MaxConns)
+		}
+	}
+}
+
+// RequestLimits bounds the size of a single request, zero values mean
+// request.DefaultMaxHeaderBytes and request.DefaultMaxBodyBytes. Larger
+// headers are answered with 431, larger bodies with 413.
+type RequestLimits struct {
+	MaxHeaderBytes int
+	MaxBodyBytes   int
+}
+
+// WithRequestLimits limits the size of requests, see RequestLimits.
+func WithRequestLimits(limits RequestLimits) Option {
+	return func(s *Server) {
+		s.requestLimits = limits
+	}
+}
+
+// Timeouts bound how long a connection may keep the server waiting. Zero
+// values mean no timeout.
+type Timeouts struct {
+	// Idle is how long a connection may wait for the first byte of its
+	// next request, the first one included.
+	Idle time.Duration
+	// Read is how long reading a request, header and body, may take once
+	// its first byte arrived.
+	Read time.Duration
+}
+
+// WithTimeouts closes connections that idle or send their requests too
+// slowly, see Timeouts.
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(s *Server) {
+		s.timeouts = timeouts
+	}
+}
+
+// newReader reads the requests of conn within the request limits.
+func (s *Server) newReader(conn net.Conn) *request.Reader {
+	reader := request.NewReader(conn)
+	reader.MaxHeaderBytes = s.requestLimits.MaxHeaderBytes
+	reader.MaxBodyBytes = s.requestLimits.MaxBodyBytes
+	return reader
+}
+
+// connTracker counts open connections, in total and per client IP.
+type connTracker struct {
+	mu    sync.Mutex
+	open  int
+	perIP map[string]int
+	all   map[*trackedConn]struct{}
+}
+
+// admit applies the connection limits to a newly accepted connection. A
+// rejected connection has been answered and closed.
+func (s *Server) admit(conn net.Conn) (net.Conn, bool) {
+	// behind a load balancer the client is only known once the PROXY
+	// header is read, see admitIP
+	var ip string
+	if s.proxyProtocol == nil {
+		ip = remoteIP(conn)
+	}
+
+	tc := &trackedConn{Conn: conn, ip: ip, info: request.ConnInfo{ID: s.nextConnID.Add(1), AcceptedAt: time.Now()}}
+	tc.release = func() { s.release(tc) }
+
+	s.conns.mu.Lock()
+	var status response.StatusCode
+	switch {
+	case s.limits.RejectWhenFull && s.limits.MaxConns > 0 && s.conns.open >= s.limits.MaxConns:
+		status = response.StatusServiceUnavailable
+	case s.limits.MaxConnsPerIP > 0 && ip != "" && s.conns.perIP[ip] >= s.limits.MaxConnsPerIP:
+		status = response.StatusTooManyRequests
+	default:
+		s.conns.open++
+		if s.conns.all == nil {
+			s.conns.all = map[*trackedConn]struct{}{}
+		}
+		s.conns.all[tc] = struct{}{}
+		if ip != "" {
+			if s.conns.perIP == nil {
+				s.conns.perIP = map[string]int{}
+			}
+			s.conns.perIP[ip]++
+		}
+	}
+	s.conns.mu.Unlock()
+
+	if status != 0 {
+		s.rejectedConns.Add(1)
+		s.reject(conn, status)
+		return nil, false
+	}
+
+	return tc, true
+}
+
+// admitIP applies MaxConnsPerIP to a connection admitted before its PROXY
+// header was read. A rejected connection has been answered, the caller
+// closes it.
+func (s *Server) admitIP(conn net.Conn) bool {
+	tc, ok := conn.(*trackedConn)
+	if !ok {
+		return true
+	}
+	ip := remoteIP(tc)
+
+	s.conns.mu.Lock()
+	full := s.limits.MaxConnsPerIP > 0 && ip != "" && s.conns.perIP[ip] >= s.limits.MaxConnsPerIP
+	if !full && ip != "" {
+		if s.conns.perIP == nil {
+			s.conns.perIP = map[string]int{}
+		}
+		s.conns.perIP[ip]++
+		tc.ip = ip
+	}
+	s.conns.mu.Unlock()
+
+	if full {
+		s.rejectedConns.Add(1)
+		s.writeReject(tc, response.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+func (s *Server) release(tc *trackedConn) {
+	s.conns.mu.Lock()
+	s.conns.open--
+	delete(s.conns.all, tc)
+	if tc.ip != "" {
+		if s.conns.perIP[tc.ip]--; s.conns.perIP[tc.ip] <= 0 {
+			delete(s.conns.perIP, tc.ip)
+		}
+	}
+	s.conns.mu.Unlock()
+
+	if s.connSlots != nil {
+		<-s.connSlots
+	}
+}
+
+// reject answers conn without reading a request. The short deadline
+// keeps a client that does not read from stalling the accept loop.
+func (s *Server) reject(conn net.Conn, status response.StatusCode) {
+	defer conn.Close()
+
+	if s.connSlots != nil {
+		<-s.connSlots
+	}
+
+	s.writeReject(conn, status)
+}
+
+// writeReject writes the response of a rejected connection.
+func (s *Server) writeReject(conn net.Conn, status response.StatusCode) {
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+
+	respWriter := response.NewBufferedWriter(conn)
+	respWriter.BeforeWriteHeaders(func(h header.Headers) {
+		h.Remove("Connection")
+		h.Add("Connection", "close")
+	})
+
+	s.writeError(respWriter, nil, &HandlerError{
+		StatusCode: status,
+		Message:    "Too many connections, try again later",
+		Headers:    header.Headers{"Retry-After": "1"},
+	})
+	respWriter.Release()
+}
+
+func remoteIP(conn net.Conn) string {
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	return addr.IP.String()
+}
+
+// trackedConn gives its connection slot back when closed.
+type trackedConn struct {
+	net.Conn
+	once     sync.Once
+	release  func()
+	ip       string      // counted towards MaxConnsPerIP, guarded by connTracker.mu
+	idle     atomic.Bool // between keep-alive requests
+	hijacked atomic.Bool // see Hijack
+
+	info     request.ConnInfo
+	infoOnce sync.Once // fills in the addresses of info
+	tlsState *tls.ConnectionState
+	requests int // served so far, one goroutine at a time serves conn
+}
+
+func (c *trackedConn) Close() error {
+	if c.hijacked.Load() {
+		return nil // the handler that took it over closes it
+	}
+
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+func (c *trackedConn) ReadFrom(r io.Reader) (int64, error) {
+	return netutil.ReadFrom(c.Conn, r)
+}
+
+// SyscallConn exposes the descriptor for the event loop.
+func (c *trackedConn) SyscallConn() (syscall.RawConn, error) {
+	sc, ok := c.Conn.(syscall.Conn)
+	if !ok {
+		return nil, syscall.EINVAL
+	}
+	return sc.SyscallConn()
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dial(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn, bufio.NewReader(conn)
+}
+
+func TestConnLimitsReject(t *testing.T) {
+	// Test: connections over MaxConns get 503 when RejectWhenFull is set
+	srv, addr := startServerWith(t, hello, WithConnLimits(ConnLimits{MaxConns: 1, RejectWhenFull: true}))
+
+	first, firstBr := dial(t, addr)
+	_, body := get(t, first, firstBr, "/")
+	assert.Equal(t, "hello /", body)
+
+	_, br := dial(t, addr)
+	resp, _ := readResponse(t, br)
+	assert.Equal(t, int(response.StatusServiceUnavailable), resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+	assert.Equal(t, 1, srv.Stats().OpenConns)
+	assert.Equal(t, uint64(1), srv.Stats().RejectedConns)
+
+	// Test: the slot is free again once the first connection closes
+	first.Close()
+	require.Eventually(t, func() bool { return srv.Stats().OpenConns == 0 }, time.Second, 10*time.Millisecond)
+
+	conn, br := dial(t, addr)
+	_, body = get(t, conn, br, "/again")
+	assert.Equal(t, "hello /again", body)
+}
+
+func TestConnLimitsPerIP(t *testing.T) {
+	// Test: a client's connections over MaxConnsPerIP get 429
+	_, addr := startServerWith(t, hello, WithConnLimits(ConnLimits{MaxConnsPerIP: 1}))
+
+	first, firstBr := dial(t, addr)
+	get(t, first, firstBr, "/")
+
+	_, br := dial(t, addr)
+	resp, _ := readResponse(t, br)
+	assert.Equal(t, int(response.StatusTooManyRequests), resp.StatusCode)
+}
+
+func TestConnLimitsBlock(t *testing.T) {
+	// Test: without RejectWhenFull new connections wait for a free slot
+	_, addr := startServerWith(t, hello, WithConnLimits(ConnLimits{MaxConns: 1}))
+
+	first, firstBr := dial(t, addr)
+	get(t, first, firstBr, "/")
+
+	second, br := dial(t, addr)
+	_, err := io.WriteString(second, "GET /second HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+
+	second.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err = br.Peek(1)
+	require.Error(t, err)
+
+	first.Close()
+	second.SetReadDeadline(time.Time{})
+	_, body := readResponse(t, br)
+	assert.Equal(t, "hello /second", body)
+}
+
+func TestRequestLimits(t *testing.T) {
+	_, addr := startServerWith(t, hello, WithRequestLimits(RequestLimits{MaxHeaderBytes: 1024, MaxBodyBytes: 10}))
+
+	// Test: oversized headers are answered with 431
+	conn, br := dial(t, addr)
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nX-Long: "+strings.Repeat("a", 2048)+"\r\n\r\n")
+	require.NoError(t, err)
+	resp, _ := readResponse(t, br)
+	assert.Equal(t, int(response.StatusHeaderFieldsTooLarge), resp.StatusCode)
+	assert.True(t, resp.Close)
+
+	// Test: oversized bodies are answered with 413
+	conn, br = dial(t, addr)
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 11\r\n\r\nhello world")
+	require.NoError(t, err)
+	resp, _ = readResponse(t, br)
+	assert.Equal(t, int(response.StatusRequestEntityTooLarge), resp.StatusCode)
+}
+
+func testTimeouts(t *testing.T, opts ...Option) {
+	opts = append(opts, WithTimeouts(Timeouts{Idle: 300 * time.Millisecond, Read: 100 * time.Millisecond}))
+	srv, addr := startServerWith(t, hello, opts...)
+
+	// Test: a keep-alive connection is closed once it idled too long
+	conn, br := dial(t, addr)
+	_, body := get(t, conn, br, "/")
+	assert.Equal(t, "hello /", body)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err := br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: so is one that never sends a request
+	conn, br = dial(t, addr)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: and one that sends its header too slowly
+	conn, br = dial(t, addr)
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\n")
+	require.NoError(t, err)
+	for range 3 {
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(conn, "X-Slow: 1\r\n")
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = br.ReadByte()
+	assert.Error(t, err)
+
+	require.Eventually(t, func() bool { return srv.Stats().OpenConns == 0 }, 2*time.Second, 10*time.Millisecond)
+
+	// Test: a connection that keeps sending requests in time stays open
+	conn, br = dial(t, addr)
+	for range 3 {
+		time.Sleep(50 * time.Millisecond)
+		_, body = get(t, conn, br, "/again")
+		assert.Equal(t, "hello /again", body)
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	testTimeouts(t)
+}
+
+func TestWorkerPool(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	srv, addr := startServerWith(t, func(w io.Writer, r *request.Request) *HandlerError {
+		if r.RequestLine.RequestTarget == "/block" {
+			started <- struct{}{}
+			<-release
+		}
+		return hello(w, r)
+	}, WithWorkerPool(1, 0))
+
+	blocked, blockedBr := dial(t, addr)
+	_, err := io.WriteString(blocked, "GET /block HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	// Test: with the only worker busy and no queue, requests get 503
+	conn, br := dial(t, addr)
+	resp, _ := get(t, conn, br, "/")
+	assert.Equal(t, int(response.StatusServiceUnavailable), resp.StatusCode)
+
+	stats := srv.Stats()
+	assert.Equal(t, int64(1), stats.ActiveHandlers)
+	assert.Equal(t, uint64(1), stats.RejectedHandlers)
+
+	close(release)
+	_, body := readResponse(t, blockedBr)
+	assert.Equal(t, "hello /block", body)
+
+	// Test: finished requests are counted
+	assert.Eventually(t, func() bool { return srv.Stats().HandledRequests == 1 }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Listen opens the listeners for a URL address:
+//
+//	tcp://127.0.0.1:8080   tcp4:// and tcp6:// restrict the IP family,
+//	tcp://:8080            tcp6://[::]:8080 listens on IPv6 only
+//	unix:///run/app.sock?mode=0660
+//	fd://3                 an inherited listening descriptor
+//	systemd://             every socket passed by systemd socket activation
+//	systemd://web          those named "web" by FileDescriptorName=
+//
+// A bare host:port is taken as tcp.
+// Listeners handed over by Upgrade are used instead of opening new ones.
+func Listen(addr string) ([]net.Listener, error) {
+	addr = normalizeAddr(addr)
+
+	if ls := takeInherited(addr); len(ls) > 0 {
+		return ls, nil
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address %q: %v", addr, err)
+	}
+
+	switch u.Scheme {
+	case "tcp", "tcp4", "tcp6":
+		l, err := net.Listen(u.Scheme, u.Host)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	case "unix":
+		l, err := listenUnix(u)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	case "fd":
+		fd, err := strconv.Atoi(u.Host)
+		if err != nil || fd < 3 {
+			return nil, fmt.Errorf("invalid descriptor in %q", addr)
+		}
+
+		l, err := fileListener(uintptr(fd), addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	case "systemd":
+		return takeActivationListeners(u.Host)
+	default:
+		return nil, fmt.Errorf("unsupported listen address scheme %q", u.Scheme)
+	}
+}
+
+func normalizeAddr(addr string) string {
+	if !strings.Contains(addr, "://") {
+		return "tcp://" + addr
+	}
+	return addr
+}
+
+func listenUnix(u *url.URL) (net.Listener, error) {
+	path := u.Path
+	if path == "" {
+		return nil, errors.New("unix listen address needs a path")
+	}
+
+	removeStaleSocket(path)
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode := u.Query().Get("mode"); mode != "" {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err == nil && perm > 0o777 {
+			err = errors.New("out of range")
+		}
+		if err == nil {
+			err = os.Chmod(path, os.FileMode(perm))
+		}
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("invalid socket mode %q: %v", mode, err)
+		}
+	}
+
+	return l, nil
+}
+
+// removeStaleSocket deletes a socket file left behind by a process that
+// did not shut down cleanly. A socket someone still listens on is kept,
+// Listen then fails with "address already in use".
+func removeStaleSocket(path string) {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return
+	}
+	os.Remove(path)
+}
+
+func fileListener(fd uintptr, name string) (net.Listener, error) {
+	f := os.NewFile(fd, name)
+	if f == nil {
+		return nil, fmt.Errorf("invalid descriptor %d", fd)
+	}
+	defer f.Close() // FileListener works on a duplicate
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("descriptor %d is not a listening socket: %v", fd, err)
+	}
+	return l, nil
+}
+
+// listenFDsStart is SD_LISTEN_FDS_START, the first descriptor systemd
+// passes.
+const listenFDsStart = 3
+
+type namedListener struct {
+	name     string
+	listener net.Listener
+}
+
+// activation holds the listeners passed by systemd. The descriptors are
+// turned into listeners once, every listener can be taken once.
+var activation struct {
+	once      sync.Once
+	mu        sync.Mutex
+	listeners []namedListener
+	err       error
+}
+
+func takeActivationListeners(name string) ([]net.Listener, error) {
+	activation.once.Do(func() {
+		activation.listeners, activation.err = activationListeners(os.Getenv, listenFDsStart)
+	})
+	if activation.err != nil {
+		return nil, activation.err
+	}
+
+	activation.mu.Lock()
+	defer activation.mu.Unlock()
+
+	var taken []net.Listener
+	rest := activation.listeners[:0]
+	for _, nl := range activation.listeners {
+		if name == "" || nl.name == name {
+			taken = append(taken, nl.listener)
+		} else {
+			rest = append(rest, nl)
+		}
+	}
+	activation.listeners = rest
+
+	if len(taken) == 0 {
+		return nil, fmt.Errorf("no socket activation listeners named %q", name)
+	}
+	return taken, nil
+}
+
+// activationListeners implements the sd_listen_fds protocol: LISTEN_PID
+// must be this process, LISTEN_FDS descriptors start at start and
+// LISTEN_FDNAMES optionally names them.
+func activationListeners(getenv func(string) string, start int) ([]namedListener, error) {
+	if pid, err := strconv.Atoi(getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets passed by socket activation")
+	}
+
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, errors.New("no sockets passed by socket activation")
+	}
+
+	var names []string
+	if v := getenv("LISTEN_FDNAMES"); v != "" {
+		names = strings.Split(v, ":")
+	}
+
+	listeners := make([]namedListener, 0, count)
+	for i := range count {
+		name := "unknown" // systemd's default
+		if i < len(names) {
+			name = names[i]
+		}
+
+		l, err := fileListener(uintptr(start+i), name)
+		if err != nil {
+			for _, nl := range listeners {
+				nl.listener.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, namedListener{name: name, listener: l})
+	}
+
+	return listeners, nil
+}
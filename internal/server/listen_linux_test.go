@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActivationListeners(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tcp.Close()
+
+	// a descriptor no *os.File owns, activationListeners closes it
+	f, err := tcp.(*net.TCPListener).File()
+	require.NoError(t, err)
+	fd, err := syscall.Dup(int(f.Fd()))
+	require.NoError(t, err)
+	f.Close()
+
+	env := map[string]string{
+		"LISTEN_PID":     strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS":     "1",
+		"LISTEN_FDNAMES": "web",
+	}
+
+	// Test: passed descriptors become named listeners
+	listeners, err := activationListeners(func(key string) string { return env[key] }, fd)
+	require.NoError(t, err)
+	require.Len(t, listeners, 1)
+	assert.Equal(t, "web", listeners[0].name)
+	assert.Equal(t, tcp.Addr().String(), listeners[0].listener.Addr().String())
+	listeners[0].listener.Close()
+
+	// Test: sockets meant for another process are ignored
+	env["LISTEN_PID"] = "1"
+	_, err = activationListeners(func(key string) string { return env[key] }, fd)
+	assert.Error(t, err)
+}
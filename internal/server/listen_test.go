@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeAddrs(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "app.sock")
+
+	srv, err := ServeAddrs([]string{"tcp://127.0.0.1:0", "unix://" + socket + "?mode=0600"}, hello)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	addrs := srv.Addrs()
+	require.Len(t, addrs, 2)
+
+	// Test: every listener serves requests
+	for _, addr := range addrs {
+		conn, err := net.Dial(addr.Network(), addr.String())
+		require.NoError(t, err)
+		_, body := get(t, conn, bufio.NewReader(conn), "/")
+		assert.Equal(t, "hello /", body)
+		conn.Close()
+	}
+
+	// Test: the unix socket gets the requested permissions
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestListen(t *testing.T) {
+	// Test: bare host:port means tcp, tcp6 stays on IPv6
+	ls, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp", ls[0].Addr().Network())
+	ls[0].Close()
+
+	if ls, err := Listen("tcp6://[::1]:0"); err == nil {
+		assert.Equal(t, "::1", ls[0].Addr().(*net.TCPAddr).IP.String())
+		ls[0].Close()
+	}
+
+	// Test: a stale socket file is replaced, a live one is not
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	ls, err = Listen("unix://" + socket)
+	require.NoError(t, err)
+	_, err = Listen("unix://" + socket)
+	assert.Error(t, err)
+
+	ls[0].(*net.UnixListener).SetUnlinkOnClose(false)
+	ls[0].Close()
+	ls, err = Listen("unix://" + socket)
+	require.NoError(t, err)
+	ls[0].Close()
+
+	// Test: bad addresses are rejected
+	for _, addr := range []string{"udp://:53", "unix://", "fd://1", "unix:///tmp/x.sock?mode=999"} {
+		_, err := Listen(addr)
+		assert.Error(t, err, addr)
+	}
+}
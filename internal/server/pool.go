@@ -0,0 +1,130 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// WithWorkerPool runs handlers on a fixed number of workers instead of
+// the connection goroutines. Up to queue requests wait for a free
+// worker, further ones are answered with 503.
+func WithWorkerPool(workers, queue int) Option {
+	return func(s *Server) {
+		s.pool = newWorkerPool(workers, queue)
+	}
+}
+
+// Stats is a snapshot of the server's connection and handler counters.
+type Stats struct {
+	OpenConns     int    // connections currently open
+	RejectedConns uint64 // connections turned away by ConnLimits
+
+	// the counters below stay zero without WithWorkerPool
+	QueuedHandlers   int64         // requests waiting for a worker
+	ActiveHandlers   int64         // requests being handled by a worker
+	RejectedHandlers uint64        // requests rejected with a full queue
+	HandledRequests  uint64        // requests a worker has finished
+	QueueWait        time.Duration // total time requests spent queued
+}
+
+func (s *Server) Stats() Stats {
+	s.conns.mu.Lock()
+	stats := Stats{OpenConns: s.conns.open, RejectedConns: s.rejectedConns.Load()}
+	s.conns.mu.Unlock()
+
+	if p := s.pool; p != nil {
+		stats.QueuedHandlers = p.queued.Load()
+		stats.ActiveHandlers = p.active.Load()
+		stats.RejectedHandlers = p.rejected.Load()
+		stats.HandledRequests = p.handled.Load()
+		stats.QueueWait = time.Duration(p.waitNanos.Load())
+	}
+	return stats
+}
+
+type workerPool struct {
+	jobs chan *poolJob
+	quit chan struct{}
+
+	queued    atomic.Int64
+	active    atomic.Int64
+	rejected  atomic.Uint64
+	handled   atomic.Uint64
+	waitNanos atomic.Int64
+}
+
+type poolJob struct {
+	run      func()
+	enqueued time.Time
+	done     chan struct{}
+	// claimed by a worker or cancelled by a stopping pool, whichever
+	// comes first
+	state atomic.Int32
+}
+
+const (
+	jobQueued int32 = iota
+	jobClaimed
+	jobCancelled
+)
+
+func newWorkerPool(workers, queue int) *workerPool {
+	p := &workerPool{jobs: make(chan *poolJob, queue), quit: make(chan struct{})}
+	for range max(workers, 1) {
+		go p.work()
+	}
+	return p
+}
+
+func (p *workerPool) work() {
+	for {
+		select {
+		case job := <-p.jobs:
+			p.queued.Add(-1)
+			if !job.state.CompareAndSwap(jobQueued, jobClaimed) {
+				continue
+			}
+			p.waitNanos.Add(int64(time.Since(job.enqueued)))
+			p.active.Add(1)
+
+			job.run()
+
+			p.active.Add(-1)
+			p.handled.Add(1)
+			close(job.done)
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// do runs fn on a worker and waits for it. It returns false without
+// running fn when the queue is full or the pool is stopped.
+func (p *workerPool) do(fn func()) bool {
+	job := &poolJob{run: fn, enqueued: time.Now(), done: make(chan struct{})}
+
+	p.queued.Add(1)
+	select {
+	case p.jobs <- job:
+	default:
+		p.queued.Add(-1)
+		p.rejected.Add(1)
+		return false
+	}
+
+	select {
+	case <-job.done:
+		return true
+	case <-p.quit:
+		if job.state.CompareAndSwap(jobQueued, jobCancelled) {
+			return false
+		}
+		// a worker got to it first
+		<-job.done
+		return true
+	}
+}
+
+func (p *workerPool) stop() {
+	close(p.quit)
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log"
+
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+)
+
+// Problem converts the error into RFC 9457 problem details.
+func (h HandlerError) Problem() response.Problem {
+	return response.Problem{
+		Title:  response.StatusText(h.StatusCode),
+		Status: h.StatusCode,
+		Detail: h.Message,
+	}
+}
+
+// WriteProblem writes the error as an application/problem+json response.
+func (h HandlerError) WriteProblem(w io.Writer) {
+	respWriter := response.NewWriter(w)
+	addErrorHeaders(respWriter, &h)
+
+	if err := respWriter.WriteProblem(h.Problem()); err != nil {
+		log.Printf("Error writing problem response: %v\n", err)
+	}
+}
+
+// DecodeJSON decodes the request body into v and maps decoding failures
+// to 415, 413 or 400 handler errors.
+func DecodeJSON(r *request.Request, v any, maxBytes int) *HandlerError {
+	err := r.DecodeJSON(v, maxBytes)
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, request.ErrUnsupportedMediaType):
+		return &HandlerError{StatusCode: response.StatusUnsupportedMediaType, Message: err.Error()}
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return &HandlerError{StatusCode: response.StatusRequestEntityTooLarge, Message: err.Error()}
+	default:
+		return &HandlerError{StatusCode: response.StatusBadRequest, Message: err.Error()}
+	}
+}
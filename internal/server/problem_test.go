@@ -0,0 +1,63 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test: decoding failures map to 415, 413 and 400
+func TestDecodeJSON(t *testing.T) {
+	var v struct {
+		Flavour string `json:"flavour"`
+	}
+	decode := func(contentType, body string, maxBytes int) *HandlerError {
+		r := &request.Request{Headers: header.Headers{"content-type": contentType}, Body: []byte(body)}
+		return DecodeJSON(r, &v, maxBytes)
+	}
+
+	assert.Nil(t, decode("application/json", `{"flavour":"darkmode"}`, 0))
+	assert.Equal(t, "darkmode", v.Flavour)
+
+	cases := map[string]struct {
+		hErr   *HandlerError
+		status response.StatusCode
+	}{
+		"wrong media type": {decode("text/plain", `{"flavour":"darkmode"}`, 0), response.StatusUnsupportedMediaType},
+		"too large":        {decode("application/json", `{"flavour":"darkmode"}`, 8), response.StatusRequestEntityTooLarge},
+		"malformed":        {decode("application/json", `{"flavour":`, 0), response.StatusBadRequest},
+		"unknown field":    {decode("application/json", `{"colour":"dark"}`, 0), response.StatusBadRequest},
+	}
+	for name, c := range cases {
+		if assert.NotNil(t, c.hErr, name) {
+			assert.Equal(t, c.status, c.hErr.StatusCode, name)
+			assert.NotEmpty(t, c.hErr.Message, name)
+		}
+	}
+}
+
+// Test: WriteProblem carries the error's status, message and headers
+func TestHandlerErrorWriteProblem(t *testing.T) {
+	var conn bytes.Buffer
+	HandlerError{
+		StatusCode: response.StatusTooManyRequests,
+		Message:    "slow down",
+		Headers:    header.Headers{"Retry-After": "30"},
+	}.WriteProblem(&conn)
+
+	resp, raw := readResponse(t, bufio.NewReader(&conn))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal([]byte(raw), &body))
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "30", resp.Header.Get("Retry-After"))
+	assert.Equal(t, map[string]any{"title": "Too Many Requests", "status": float64(429), "detail": "slow down"}, body)
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+
+	"github.com/harry713j/http-server/internal/proxyproto"
+)
+
+// WithProxyProtocol reads a PROXY protocol v1 or v2 header at the start
+// of connections from opts.Trusted, as sent by TCP load balancers. The
+// client and destination address from the header end up on
+// Request.Proxy. MaxConnsPerIP counts the client address from the
+// header, not the balancer's, once the header has been read.
+func WithProxyProtocol(opts proxyproto.Options) Option {
+	return func(s *Server) {
+		s.proxyProtocol = &opts
+	}
+}
+
+// proxyConn returns the PROXY protocol connection under conn, nil if the
+// listener doesn't read PROXY headers.
+func proxyConn(conn net.Conn) *proxyproto.Conn {
+	if tc, ok := conn.(*trackedConn); ok {
+		conn = tc.Conn
+	}
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+
+	pc, _ := conn.(*proxyproto.Conn)
+	return pc
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/harry713j/http-server/internal/proxyproto"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func clientAddr(w io.Writer, r *request.Request) *HandlerError {
+	if r.Proxy == nil {
+		w.Write([]byte("direct"))
+		return nil
+	}
+	w.Write([]byte(r.Proxy.Source.String() + " -> " + r.Proxy.Destination.String()))
+	return nil
+}
+
+func TestProxyProtocol(t *testing.T) {
+	_, addr := startServerWith(t, clientAddr, WithProxyProtocol(proxyproto.Options{}))
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	// Test: the addresses from the header are on every request of the
+	// connection
+	_, err = io.WriteString(conn, "PROXY TCP4 192.0.2.1 198.51.100.7 51234 443\r\n")
+	require.NoError(t, err)
+	_, body := get(t, conn, br, "/")
+	assert.Equal(t, "192.0.2.1:51234 -> 198.51.100.7:443", body)
+	_, body = get(t, conn, br, "/")
+	assert.Equal(t, "192.0.2.1:51234 -> 198.51.100.7:443", body)
+
+	// Test: a connection without a header is closed
+	conn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	_, err = bufio.NewReader(conn).ReadByte()
+	assert.Error(t, err)
+}
+
+// Test: headers from untrusted sources are not parsed
+func TestProxyProtocolUntrusted(t *testing.T) {
+	opts := proxyproto.Options{Trusted: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	_, addr := startServerWith(t, clientAddr, WithProxyProtocol(opts))
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	_, body := get(t, conn, br, "/")
+	assert.Equal(t, "direct", body)
+
+	conn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "PROXY TCP4 192.0.2.1 198.51.100.7 51234 443\r\nGET / HTTP/1.1\r\n\r\n")
+	require.NoError(t, err)
+	resp, _ := readResponse(t, bufio.NewReader(conn))
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+// Test: MaxConnsPerIP counts the clients behind the load balancer, not
+// the load balancer
+func TestProxyProtocolConnsPerIP(t *testing.T) {
+	srv, addr := startServerWith(t, clientAddr, WithProxyProtocol(proxyproto.Options{}), WithConnLimits(ConnLimits{MaxConnsPerIP: 1}))
+
+	proxied := func(source string) (net.Conn, *bufio.Reader) {
+		conn, br := dial(t, addr)
+		_, err := io.WriteString(conn, "PROXY TCP4 "+source+" 198.51.100.7 51234 443\r\n")
+		require.NoError(t, err)
+		return conn, br
+	}
+
+	first, firstBr := proxied("192.0.2.1")
+	_, body := get(t, first, firstBr, "/")
+	assert.Equal(t, "192.0.2.1:51234 -> 198.51.100.7:443", body)
+
+	second, secondBr := proxied("192.0.2.2")
+	_, body = get(t, second, secondBr, "/")
+	assert.Equal(t, "192.0.2.2:51234 -> 198.51.100.7:443", body)
+
+	_, br := proxied("192.0.2.1")
+	resp, _ := readResponse(t, br)
+	assert.Equal(t, int(response.StatusTooManyRequests), resp.StatusCode)
+	assert.Equal(t, uint64(1), srv.Stats().RejectedConns)
+
+	// Test: the client's slot is free again once its connection closes
+	first.Close()
+	require.Eventually(t, func() bool { return srv.Stats().OpenConns == 1 }, time.Second, 10*time.Millisecond)
+	conn, br := proxied("192.0.2.1")
+	_, body = get(t, conn, br, "/")
+	assert.Equal(t, "192.0.2.1:51234 -> 198.51.100.7:443", body)
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/netutil"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readFromListener hands out connections that record which sources
+// reach their ReadFrom, the zero-copy entry point of *net.TCPConn.
+type readFromListener struct {
+	net.Listener
+	mu      sync.Mutex
+	sources []string
+}
+
+func (l *readFromListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &readFromConn{Conn: conn, l: l}, nil
+}
+
+func (l *readFromListener) Sources() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.sources...)
+}
+
+type readFromConn struct {
+	net.Conn
+	l *readFromListener
+}
+
+func (c *readFromConn) ReadFrom(r io.Reader) (int64, error) {
+	c.l.mu.Lock()
+	c.l.sources = append(c.l.sources, fmt.Sprintf("%T", r))
+	c.l.mu.Unlock()
+	return netutil.ReadFrom(c.Conn, r)
+}
+
+// serveFile answers every request with the file at path, passed through
+// wrap and announced as size bytes long.
+func serveFile(path string, size int64, wrap func(file *os.File) io.Reader) Handler {
+	return func(w io.Writer, r *request.Request) *HandlerError {
+		file, err := os.Open(path)
+		if err != nil {
+			return &HandlerError{StatusCode: response.StatusInternalServerError, Message: err.Error(), Cause: err}
+		}
+		defer file.Close()
+
+		respWriter := response.NewWriter(w)
+		if err := respWriter.WriteStatusLine(response.StatusOk); err != nil {
+			return &HandlerError{StatusCode: response.StatusInternalServerError, Message: err.Error()}
+		}
+		if err := respWriter.WriteHeaders(header.Headers{"Content-Length": strconv.FormatInt(size, 10)}); err != nil {
+			return &HandlerError{StatusCode: response.StatusInternalServerError, Message: err.Error()}
+		}
+		if _, err := respWriter.WriteBodyFrom(wrap(file)); err != nil {
+			return &HandlerError{StatusCode: response.StatusInternalServerError, Message: err.Error()}
+		}
+		return nil
+	}
+}
+
+func writeFile(t testing.TB, size int) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "vim.mp4")
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte('a' + i%26)
+	}
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+// Test: a file body reaches the socket's ReadFrom through connWriter and
+// trackedConn, so sendfile(2) is used, for whole files and ranges alike
+func TestZeroCopyThroughServer(t *testing.T) {
+	path := writeFile(t, 64<<10)
+
+	tests := []struct {
+		name   string
+		size   int64
+		wrap   func(file *os.File) io.Reader
+		body   string
+		source string
+	}{
+		{"file", 64 << 10, func(file *os.File) io.Reader { return file }, "", "*os.File"},
+		{"range", 10, func(file *os.File) io.Reader {
+			file.Seek(26, io.SeekStart)
+			return io.LimitReader(file, 10)
+		}, "abcdefghij", "*io.LimitedReader"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tcp, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			l := &readFromListener{Listener: tcp}
+
+			srv, err := ServeListeners([]net.Listener{l}, serveFile(path, tt.size, tt.wrap))
+			require.NoError(t, err)
+			t.Cleanup(func() { srv.Close() })
+
+			conn, br := dial(t, srv.Addrs()[0].String())
+			resp, body := get(t, conn, br, "/video")
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Len(t, body, int(tt.size))
+			if tt.body != "" {
+				assert.Equal(t, tt.body, body)
+			}
+			assert.Equal(t, []string{tt.source}, l.Sources())
+		})
+	}
+}
+
+const videoSize = 16 << 20
+
+// benchmarkVideo fetches a video sized file from a server the way a
+// client of /video does.
+func benchmarkVideo(b *testing.B, wrap func(file *os.File) io.Reader) {
+	path := writeFile(b, videoSize)
+	_, addr := startServerWith(b, serveFile(path, videoSize, wrap))
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(b, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	b.SetBytes(videoSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := io.WriteString(conn, "GET /video HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		require.NoError(b, err)
+
+		resp, err := http.ReadResponse(br, nil)
+		require.NoError(b, err)
+		n, err := io.Copy(io.Discard, resp.Body)
+		require.NoError(b, err)
+		require.Equal(b, int64(videoSize), n)
+	}
+}
+
+func BenchmarkVideoSendfile(b *testing.B) {
+	benchmarkVideo(b, func(file *os.File) io.Reader { return file })
+}
+
+func BenchmarkVideoBufferedCopy(b *testing.B) {
+	// hiding the *os.File rules out the zero-copy path
+	benchmarkVideo(b, func(file *os.File) io.Reader { return struct{ io.Reader }{file} })
+}
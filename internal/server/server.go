@@ -1,21 +1,56 @@
 package server
 
 import (
-	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/proxyproto"
 	"github.com/harry713j/http-server/internal/request"
 	"github.com/harry713j/http-server/internal/response"
 )
 
 type Server struct {
-	listener net.Listener
-	closed   atomic.Bool // to prevent race condition
-	handler  Handler
+	listeners      []net.Listener
+	rawListeners   []net.Listener   // listeners before TLS, handed over by Upgrade
+	listenerKeys   []string         // listen address of each listener
+	newUpgradeCmd  func() *exec.Cmd // overrides the command Upgrade starts, for tests
+	closed         atomic.Bool      // to prevent race condition
+	handler        Handler
+	errorRenderer  ErrorRenderer
+	eventLoop      bool
+	loop           *eventLoop
+	limits         ConnLimits
+	requestLimits  RequestLimits
+	timeouts       Timeouts
+	connSlots      chan struct{} // blocking MaxConns, one token per open connection
+	conns          connTracker
+	rejectedConns  atomic.Uint64
+	nextConnID     atomic.Uint64
+	pool           *workerPool
+	done           chan struct{}   // closed by Close
+	ctx            context.Context // parent of the request contexts
+	cancel         context.CancelCauseFunc
+	handlerTimeout time.Duration
+	acceptHook     func(err error, retryIn time.Duration)
+	shedIdle       int  // idle connections closed when out of descriptors, see WithShedIdleConns
+	shedding       bool // WithShedIdleConns was given
+	tlsConfig      *TLSConfig
+	proxyProtocol  *proxyproto.Options
+	certs          *certStore
 }
 
 type Handler func(w io.Writer, r *request.Request) *HandlerError
@@ -23,109 +58,535 @@ type Handler func(w io.Writer, r *request.Request) *HandlerError
 type HandlerError struct {
 	StatusCode response.StatusCode
 	Message    string
+	// Headers are added to the error response, e.g. Retry-After or
+	// WWW-Authenticate
+	Headers header.Headers
+	// Cause is logged by the server but never sent to the client
+	Cause error
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
-	addr := fmt.Sprintf(":%d", port)
-	listener, err := net.Listen("tcp", addr)
+// Option configures optional Server behaviour in Serve.
+type Option func(*Server)
+
+// WithErrorRenderer replaces DefaultErrorRenderer for HandlerErrors.
+func WithErrorRenderer(renderer ErrorRenderer) Option {
+	return func(s *Server) {
+		s.errorRenderer = renderer
+	}
+}
+
+// WithEventLoop serves connections from an epoll event loop instead of
+// a goroutine per connection. Idle keep-alive connections then cost no
+// goroutine and no buffer, a worker only starts once a full request
+// header has arrived. Linux only, Serve fails elsewhere.
+func WithEventLoop() Option {
+	return func(s *Server) {
+		s.eventLoop = true
+	}
+}
+
+// Serve listens on port and returns once it does. Connections are
+// accepted and served in the background until Close or Shutdown.
+func Serve(port int, handler Handler, opts ...Option) (*Server, error) {
+	addr := fmt.Sprintf("tcp://:%d", port)
+	listeners, err := Listen(addr)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to listen on port %d: %v", port, err)
 	}
 
-	srv := &Server{listener: listener, handler: handler}
+	return serveListeners(listeners, []string{addr}, handler, opts...)
+}
+
+// ServeAddrs listens on every address, see Listen for the formats, and
+// serves them all with one Server.
+func ServeAddrs(addrs []string, handler Handler, opts ...Option) (*Server, error) {
+	var listeners []net.Listener
+	var keys []string
+	for _, addr := range addrs {
+		ls, err := Listen(addr)
+		if err != nil {
+			closeAll(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, ls...)
+		for range ls {
+			keys = append(keys, normalizeAddr(addr))
+		}
+	}
+
+	return serveListeners(listeners, keys, handler, opts...)
+}
+
+// ServeListeners serves already open listeners, which the Server owns
+// from then on.
+func ServeListeners(listeners []net.Listener, handler Handler, opts ...Option) (*Server, error) {
+	keys := make([]string, len(listeners))
+	for i, l := range listeners {
+		keys[i] = l.Addr().Network() + "://" + l.Addr().String()
+	}
+
+	return serveListeners(listeners, keys, handler, opts...)
+}
+
+// serveListeners starts the Server. keys are the listen addresses the
+// listeners were opened for, they identify them across Upgrade.
+func serveListeners(listeners []net.Listener, keys []string, handler Handler, opts ...Option) (*Server, error) {
+	if len(listeners) == 0 {
+		return nil, errors.New("no listeners to serve")
+	}
+
+	srv := &Server{
+		listeners:     slices.Clone(listeners),
+		rawListeners:  listeners,
+		listenerKeys:  keys,
+		handler:       handler,
+		errorRenderer: DefaultErrorRenderer,
+		done:          make(chan struct{}),
+	}
+	srv.ctx, srv.cancel = context.WithCancelCause(context.Background())
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+
+	fail := func(err error) (*Server, error) {
+		close(srv.done)
+		closeAll(listeners)
+		return nil, err
+	}
+
+	// the PROXY header comes before the TLS handshake
+	if srv.proxyProtocol != nil {
+		if srv.eventLoop {
+			return fail(errors.New("the PROXY protocol cannot be combined with the event loop mode"))
+		}
+		for i, l := range srv.listeners {
+			srv.listeners[i] = proxyproto.NewListener(l, *srv.proxyProtocol)
+		}
+	}
+
+	if srv.tlsConfig != nil {
+		conf, err := srv.setupTLS()
+		if err != nil {
+			return fail(err)
+		}
+		for i, l := range srv.listeners {
+			srv.listeners[i] = tls.NewListener(l, conf)
+		}
+	}
+
+	if srv.eventLoop {
+		loop, err := newEventLoop(srv)
+		if err != nil {
+			return fail(err)
+		}
+		srv.loop = loop
+		go loop.run()
+	}
 
-	srv.listen()
+	for _, l := range srv.listeners {
+		go srv.listen(l)
+	}
 
 	return srv, nil
 }
 
+// Addrs returns the addresses the server listens on.
+func (s *Server) Addrs() []net.Addr {
+	addrs := make([]net.Addr, len(s.listeners))
+	for i, l := range s.listeners {
+		addrs[i] = l.Addr()
+	}
+	return addrs
+}
+
+// Close stops the server right away and closes idle keep-alive
+// connections. Connections in the middle of a request are left to finish
+// it, but its context is cancelled. See Shutdown for a graceful stop.
 func (s *Server) Close() error {
 	if s.closed.Swap(true) {
 		return nil
 	}
 
-	return s.listener.Close()
+	err := s.stopAccepting()
+	s.closeIdleConns(0)
+	s.cancel(ErrServerClosed)
+	if s.pool != nil {
+		s.pool.stop()
+	}
+	return err
+}
+
+// Shutdown stops accepting, closes idle keep-alive connections and waits
+// up to timeout for the rest to finish their current request. What is
+// still open then is closed, and the contexts of its requests are
+// cancelled.
+func (s *Server) Shutdown(timeout time.Duration) error {
+	if s.closed.Swap(true) {
+		return nil
+	}
+
+	err := s.stopAccepting()
+
+	deadline := time.Now().Add(timeout)
+	for s.closeIdleConns(0); s.Stats().OpenConns > 0; s.closeIdleConns(0) {
+		if time.Now().After(deadline) {
+			s.cancel(ErrServerClosed)
+			s.closeAllConns()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.cancel(ErrServerClosed)
+
+	if s.pool != nil {
+		s.pool.stop()
+	}
+	return err
+}
+
+func (s *Server) stopAccepting() error {
+	close(s.done)
+	err := closeAll(s.listeners)
+	if s.loop != nil {
+		s.loop.close()
+	}
+	return err
 }
 
-func (s *Server) listen() {
+func closeAll(listeners []net.Listener) error {
+	var errs []error
+	for _, l := range listeners {
+		if err := l.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) listen(listener net.Listener) {
+	var retryIn time.Duration
+
 	for {
-		conn, err := s.listener.Accept()
+		// with a blocking connection limit, wait for a free slot before
+		// accepting so new connections queue up in the kernel
+		if s.connSlots != nil {
+			select {
+			case s.connSlots <- struct{}{}:
+			case <-s.done:
+				return
+			}
+		}
+
+		conn, err := listener.Accept()
 
 		if err != nil {
+			if s.connSlots != nil {
+				<-s.connSlots
+			}
+
 			if s.closed.Load() {
 				return // if the server closed
 			}
 
-			log.Printf("Connection error: %v\n", err)
+			if !s.acceptFailed(err, &retryIn) {
+				return
+			}
 			continue
 		}
+		retryIn = 0
 
-		go s.handle(conn)
+		conn, ok := s.admit(conn)
+		if !ok {
+			continue
+		}
+
+		if s.loop != nil {
+			if err := s.loop.add(conn); err != nil {
+				log.Printf("Event loop error: %v\n", err)
+				conn.Close()
+			}
+			continue
+		}
+
+		go s.serveConn(conn)
 	}
 }
 
-func (s *Server) handle(conn net.Conn) {
+// serveConn serves requests on conn until either side closes it.
+func (s *Server) serveConn(conn net.Conn) {
 	defer conn.Close()
 
+	if pc := proxyConn(conn); pc != nil {
+		if _, err := pc.ReadHeader(); err != nil {
+			log.Printf("PROXY header error from %v: %v\n", pc.Conn.RemoteAddr(), err)
+			return
+		}
+		if !s.admitIP(conn) {
+			return
+		}
+	}
+
+	// a failed handshake has no channel to answer on
+	if tc := tlsConn(conn); tc != nil {
+		conn.SetDeadline(time.Now().Add(cmp.Or(s.tlsConfig.HandshakeTimeout, DefaultHandshakeTimeout)))
+		if err := tc.Handshake(); err != nil {
+			log.Printf("TLS handshake error from %v: %v\n", conn.RemoteAddr(), err)
+			return
+		}
+		conn.SetDeadline(time.Time{})
+	}
+
+	reader := s.newReader(conn)
+	defer reader.Release()
+
+	for s.awaitRequest(conn, reader) && s.serveRequest(conn, reader) {
+		if s.closed.Load() {
+			return // shutting down
+		}
+	}
+}
+
+// awaitRequest waits up to the idle timeout for the first byte of the next
+// request. Until it arrives the connection is idle, free to be closed by
+// Close, Shutdown or shedding, but not a moment longer, so none of them
+// cuts off a request being read. It reports false if the connection timed
+// out or was closed meanwhile.
+func (s *Server) awaitRequest(conn net.Conn, reader *request.Reader) bool {
+	if reader.Buffered() > 0 {
+		return true // pipelined request already read
+	}
+
+	// Close marks the server closed before it closes the idle
+	// connections, so either it sees this one idle or we see it closed
+	setIdle(conn, true)
+	if s.closed.Load() {
+		return false
+	}
+
+	if s.timeouts.Idle > 0 {
+		conn.SetReadDeadline(time.Now().Add(s.timeouts.Idle))
+		defer conn.SetReadDeadline(time.Time{})
+	}
+
+	_, err := reader.ReadAhead()
+	setIdle(conn, false)
+	return err == nil || reader.Buffered() > 0
+}
+
+// serveRequest reads one request from reader and writes its response. It
+// reports whether the connection can carry another request.
+func (s *Server) serveRequest(conn net.Conn, reader *request.Reader) (keepAlive bool) {
+	// everything is written to a pooled buffer, releasing it is the final
+	// flush of the response
+	out := &connWriter{Conn: conn}
+	respWriter := response.NewBufferedWriter(out)
+	defer func() {
+		if err := respWriter.Release(); err != nil {
+			log.Printf("Error flushing response: %v\n", err)
+			keepAlive = false
+		}
+	}()
+
 	// parse request
-	req, err := request.RequestFromReader(conn)
+	if s.timeouts.Read > 0 {
+		conn.SetReadDeadline(time.Now().Add(s.timeouts.Read))
+	}
+	req, err := reader.ReadRequest()
+	if s.timeouts.Read > 0 {
+		conn.SetReadDeadline(time.Time{})
+	}
 
 	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+			return false // closed between requests
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return false // too slow, not worth an answer
+		}
+
 		hErr := &HandlerError{
 			StatusCode: response.StatusBadRequest,
 			Message:    err.Error(),
 		}
-		hErr.Write(conn)
-		return
+		switch {
+		case errors.Is(err, request.ErrHeaderTooLarge):
+			hErr.StatusCode = response.StatusHeaderFieldsTooLarge
+		case errors.Is(err, request.ErrBodyTooLarge):
+			hErr.StatusCode = response.StatusRequestEntityTooLarge
+		}
+		s.writeError(respWriter, nil, hErr)
+		return false
 	}
 
-	buff := bytes.NewBuffer([]byte{})
+	connRequest(conn, req)
+	if pc := proxyConn(conn); pc != nil {
+		req.Proxy = pc.Header()
+	}
+
+	hj := &hijacker{conn: conn, reader: reader, w: respWriter}
+	ctx, cancel := s.requestContext(out)
+	defer cancel(nil)
+	req.SetContext(context.WithValue(ctx, hijackKey{}, hj))
+	keepAlive = wantsKeepAlive(req)
+
+	// registered before any handler hook, those only ever switch the body
+	// from Content-Length to chunked, both of which end on their own
+	respWriter.BeforeWriteHeaders(func(h header.Headers) {
+		// after a 101 the connection speaks the protocol the handler
+		// switched to, its Connection: Upgrade stays
+		if respWriter.Status() == response.StatusSwitchingProtocols {
+			keepAlive = false
+			return
+		}
 
-	if hErr := s.handler(buff, req); hErr != nil {
-		hErr.Write(conn)
-		return
+		keepAlive = keepAlive && !s.closed.Load() && bodyDelimited(req.RequestLine.Method, respWriter.Status(), h)
+
+		h.Remove("Connection")
+		if keepAlive {
+			h.Add("Connection", "keep-alive")
+		} else {
+			h.Add("Connection", "close")
+		}
+	})
+
+	// the body was read with the request, anything the client sends while
+	// the handler runs is a pipelined request or the end of the connection
+	if reader.Buffered() == 0 {
+		hj.stopWatch = watchConn(conn, reader, cancel)
+	}
+
+	hErr := s.runHandler(respWriter, req)
+	if hj.done.Load() {
+		return false // the connection belongs to the handler now
+	}
+	if hj.stopWatch != nil && !hj.stopWatch() {
+		keepAlive = false
+	}
+
+	if hErr != nil {
+		if respWriter.Started() {
+			log.Printf("Handler error after response started: %v\n", hErr)
+			return false
+		}
+		s.writeError(respWriter, req, hErr)
+		return keepAlive
+	}
+
+	// the handler wrote the whole response itself
+	if respWriter.Started() {
+		if err := respWriter.Finish(); err != nil {
+			log.Printf("Error finishing response body: %v\n", err)
+			return false
+		}
+		return keepAlive
 	}
 
 	status := response.StatusOk
-	responseBody := buff.Bytes()
+	responseBody := respWriter.Buffered()
 
-	if err := response.WriteStatusLine(conn, status); err != nil {
+	if err := respWriter.WriteStatusLine(status); err != nil {
 		log.Printf("Error writing response line: %v\n", err)
-		return
+		return false
 	}
 
 	headers := response.GetDefaultHeaders(len(responseBody))
-	if err := response.WriteHeaders(conn, headers); err != nil {
+	headers["Content-Length"] = strconv.Itoa(len(responseBody))
+	if err := respWriter.WriteHeaders(headers); err != nil {
 		log.Printf("Error writing headers: %v\n", err)
-		return
+		return false
 	}
 
 	if len(responseBody) > 0 {
-		if _, err := conn.Write(responseBody); err != nil {
+		if _, err := respWriter.WriteBody(responseBody); err != nil {
 			log.Printf("Error writing response body: %v\n", err)
-			return
+			return false
 		}
 	}
+
+	return keepAlive
 }
 
-func (h HandlerError) Write(w io.Writer) {
-	errRespBody := []byte(h.Message)
-	headers := response.GetDefaultHeaders(len(errRespBody))
+// runHandler calls the handler, on a pool worker if there is a pool.
+func (s *Server) runHandler(w *response.Writer, r *request.Request) *HandlerError {
+	if s.pool == nil {
+		return s.handler(w, r)
+	}
 
-	if err := response.WriteStatusLine(w, h.StatusCode); err != nil {
-		log.Printf("Error writing response line: %v\n", err)
-		return
+	var hErr *HandlerError
+	if !s.pool.do(func() { hErr = s.handler(w, r) }) {
+		return &HandlerError{
+			StatusCode: response.StatusServiceUnavailable,
+			Message:    "Server is busy, try again later",
+			Headers:    header.Headers{"Retry-After": "1"},
+		}
 	}
+	return hErr
+}
 
-	if err := response.WriteHeaders(w, headers); err != nil {
-		log.Printf("Error writing headers: %v\n", err)
-		return
+// wantsKeepAlive applies the HTTP/1.x defaults: 1.1 connections persist
+// unless the client sends "Connection: close", 1.0 ones only when it
+// asks for keep-alive. Chunked request bodies are not read by the
+// parser, so those connections cannot be reused.
+func wantsKeepAlive(r *request.Request) bool {
+	if r.Headers.Get("Transfer-Encoding") != "" {
+		return false
+	}
+
+	connection := r.Headers.Get("Connection")
+	if r.RequestLine.HttpVersion == "1.0" {
+		return hasToken(connection, "keep-alive")
+	}
+	return !hasToken(connection, "close")
+}
+
+// bodyDelimited reports whether the client can find the end of the
+// response without the connection being closed.
+func bodyDelimited(method string, status response.StatusCode, h header.Headers) bool {
+	if method == "HEAD" || status < 200 || status == response.StatusNoContent || status == response.StatusNotModified {
+		return true
+	}
+
+	if h.Get("Content-Length") != "" {
+		return true
+	}
+	return hasToken(h.Get("Transfer-Encoding"), "chunked")
+}
+
+func hasToken(value, token string) bool {
+	for _, part := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(part), token) {
+			return true
+		}
 	}
+	return false
+}
 
-	if _, err := w.Write(errRespBody); err != nil {
-		log.Printf("Error writing error body: %v\n", err)
-		return
+func (s *Server) writeError(w *response.Writer, r *request.Request, hErr *HandlerError) {
+	if hErr.Cause != nil {
+		log.Printf("Handler error: %v\n", hErr)
 	}
 
+	if err := s.errorRenderer(w, r, hErr); err != nil {
+		log.Printf("Error writing error response: %v\n", err)
+	}
+}
+
+func (h HandlerError) Error() string {
+	if h.Cause != nil {
+		return fmt.Sprintf("%d %s: %v", h.StatusCode, h.Message, h.Cause)
+	}
+	return fmt.Sprintf("%d %s", h.StatusCode, h.Message)
+}
+
+func (h HandlerError) Unwrap() error {
+	return h.Cause
+}
+
+// Write writes the error as a text/plain response.
+func (h HandlerError) Write(w io.Writer) {
+	if err := renderText(response.NewWriter(w), &h); err != nil {
+		log.Printf("Error writing error response: %v\n", err)
+	}
 }
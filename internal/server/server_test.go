@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hello(w io.Writer, r *request.Request) *HandlerError {
+	w.Write([]byte("hello " + r.RequestLine.RequestTarget))
+	return nil
+}
+
+func startServer(t testing.TB, opts ...Option) string {
+	t.Helper()
+
+	_, addr := startServerWith(t, hello, opts...)
+	return addr
+}
+
+func startServerWith(t testing.TB, handler Handler, opts ...Option) (*Server, string) {
+	t.Helper()
+
+	srv, err := Serve(0, handler, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { srv.Close() })
+
+	return srv, srv.Addrs()[0].String()
+}
+
+// get sends a GET request on conn and reads the response.
+func get(t testing.TB, conn net.Conn, br *bufio.Reader, target string) (*http.Response, string) {
+	t.Helper()
+
+	_, err := io.WriteString(conn, "GET "+target+" HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	return readResponse(t, br)
+}
+
+func readResponse(t testing.TB, br *bufio.Reader) (*http.Response, string) {
+	t.Helper()
+
+	resp, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func testKeepAlive(t *testing.T, opts ...Option) {
+	addr := startServer(t, opts...)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	// Test: HTTP/1.1 connections persist, pipelined requests included
+	_, err = io.WriteString(conn, "GET /one HTTP/1.1\r\nHost: localhost\r\n\r\nGET /two HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+
+	resp, body := readResponse(t, br)
+	assert.False(t, resp.Close)
+	assert.Equal(t, "hello /one", body)
+
+	resp, body = readResponse(t, br)
+	assert.False(t, resp.Close)
+	assert.Equal(t, "hello /two", body)
+
+	// Test: a later request on the idle connection is served as well
+	_, err = io.WriteString(conn, "GET /three HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	_, body = readResponse(t, br)
+	assert.Equal(t, "hello /three", body)
+
+	// Test: Connection: close ends the connection after the response
+	_, err = io.WriteString(conn, "GET /four HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	resp, body = readResponse(t, br)
+	assert.True(t, resp.Close)
+	assert.Equal(t, "hello /four", body)
+
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: HTTP/1.0 closes unless the client asks for keep-alive
+	conn, err = net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	br = bufio.NewReader(conn)
+
+	_, err = io.WriteString(conn, "GET /five HTTP/1.0\r\n\r\n")
+	require.NoError(t, err)
+	resp, _ = readResponse(t, br)
+	assert.True(t, resp.Close)
+}
+
+func testCloseIdleConns(t *testing.T, opts ...Option) {
+	srv, addr := startServerWith(t, hello, opts...)
+
+	conn, br := dial(t, addr)
+	_, body := get(t, conn, br, "/")
+	assert.Equal(t, "hello /", body)
+
+	// Test: Close ends idle keep-alive connections
+	require.NoError(t, srv.Close())
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+	require.Eventually(t, func() bool { return srv.Stats().OpenConns == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestCloseIdleConns(t *testing.T) {
+	testCloseIdleConns(t)
+}
+
+func TestKeepAlive(t *testing.T) {
+	testKeepAlive(t)
+}
@@ -0,0 +1,307 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TLSConfig configures TLS termination for WithTLS.
+type TLSConfig struct {
+	// Certificates are served by SNI server name. The first one is the
+	// default for clients that send no or an unknown name.
+	Certificates []CertFile
+	// MinVersion defaults to TLS 1.2.
+	MinVersion uint16
+	// CipherSuites restricts the TLS 1.2 suites, nil keeps Go's defaults.
+	// TLS 1.3 suites are not configurable.
+	CipherSuites []uint16
+	// ReloadInterval checks the files for changes this often and
+	// reloads them. 0 disables polling, ReloadTLS still works.
+	ReloadInterval time.Duration
+	// HandshakeTimeout closes connections that do not finish the
+	// handshake in time, it defaults to DefaultHandshakeTimeout.
+	HandshakeTimeout time.Duration
+
+	// ClientCAFiles are PEM bundles of the CAs client certificates are
+	// verified against. Setting them turns on mutual TLS.
+	ClientCAFiles []string
+	// ClientAuth defaults to tls.VerifyClientCertIfGiven when there are
+	// ClientCAFiles, so routes without a requirement stay open to clients
+	// without a certificate. Use the mtls middleware to require one.
+	ClientAuth tls.ClientAuthType
+	// CRLFiles are PEM or DER revocation lists. A client certificate
+	// listed by a CRL signed by its issuer fails the handshake.
+	CRLFiles []string
+}
+
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// CertFile is a PEM certificate chain and its private key.
+type CertFile struct {
+	CertFile string
+	KeyFile  string
+}
+
+// WithTLS serves TLS on the listener. It cannot be combined with
+// WithEventLoop, which needs to read the plaintext request header.
+func WithTLS(cfg TLSConfig) Option {
+	return func(s *Server) {
+		s.tlsConfig = &cfg
+	}
+}
+
+// ReloadTLS reads the certificate files again, for instance on SIGHUP.
+// On error the certificates in use are kept.
+func (s *Server) ReloadTLS() error {
+	if s.certs == nil {
+		return errors.New("server does not use TLS")
+	}
+	return s.certs.reload()
+}
+
+// certStore holds the loaded certificates and swaps them atomically on
+// reload, handshakes in flight keep the set they started with.
+type certStore struct {
+	cfg     *TLSConfig
+	current atomic.Pointer[certSet]
+	mu      sync.Mutex // serializes reloads
+	modTime time.Time  // newest file modification seen by the last load
+}
+
+type certSet struct {
+	byName      map[string]*tls.Certificate
+	defaultCert *tls.Certificate
+	config      *tls.Config // handed to each handshake
+}
+
+func newCertStore(cfg *TLSConfig) (*certStore, error) {
+	if len(cfg.Certificates) == 0 {
+		return nil, errors.New("TLS needs at least one certificate")
+	}
+
+	cs := &certStore{cfg: cfg}
+	if err := cs.reload(); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+func (cs *certStore) reload() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.load()
+}
+
+func (cs *certStore) load() error {
+	modTime, err := cs.newestModTime()
+	if err != nil {
+		return err
+	}
+
+	set := &certSet{byName: map[string]*tls.Certificate{}}
+	for _, f := range cs.cfg.Certificates {
+		cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load certificate %s: %v", f.CertFile, err)
+		}
+
+		if cert.Leaf == nil {
+			if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+				return fmt.Errorf("failed to parse certificate %s: %v", f.CertFile, err)
+			}
+		}
+
+		if set.defaultCert == nil {
+			set.defaultCert = &cert
+		}
+
+		names := cert.Leaf.DNSNames
+		if len(names) == 0 && cert.Leaf.Subject.CommonName != "" {
+			names = []string{cert.Leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			// the first certificate listing a name wins
+			if _, ok := set.byName[strings.ToLower(name)]; !ok {
+				set.byName[strings.ToLower(name)] = &cert
+			}
+		}
+	}
+
+	if set.config, err = cs.newConfig(); err != nil {
+		return err
+	}
+
+	cs.current.Store(set)
+	cs.modTime = modTime
+	return nil
+}
+
+func (cs *certStore) newConfig() (*tls.Config, error) {
+	minVersion := cs.cfg.MinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+
+	conf := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cs.cfg.CipherSuites,
+		GetCertificate: cs.getCertificate,
+		NextProtos:     []string{"http/1.1"},
+	}
+
+	if len(cs.cfg.ClientCAFiles) > 0 {
+		pool, err := loadClientCAs(cs.cfg.ClientCAFiles)
+		if err != nil {
+			return nil, err
+		}
+		conf.ClientCAs = pool
+
+		conf.ClientAuth = cs.cfg.ClientAuth
+		if conf.ClientAuth == tls.NoClientCert {
+			conf.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	if len(cs.cfg.CRLFiles) > 0 {
+		crls, err := loadCRLs(cs.cfg.CRLFiles)
+		if err != nil {
+			return nil, err
+		}
+		conf.VerifyConnection = checkRevocation(crls)
+	}
+
+	return conf, nil
+}
+
+func (cs *certStore) newestModTime() (time.Time, error) {
+	var files []string
+	files = append(files, cs.cfg.ClientCAFiles...)
+	files = append(files, cs.cfg.CRLFiles...)
+	for _, f := range cs.cfg.Certificates {
+		files = append(files, f.CertFile, f.KeyFile)
+	}
+
+	var newest time.Time
+	for _, name := range files {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest, nil
+}
+
+// getCertificate picks a certificate by SNI, trying the exact name and
+// then a wildcard for its parent domain.
+func (cs *certStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := cs.current.Load()
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		if cert, ok := set.byName[name]; ok {
+			return cert, nil
+		}
+		if _, parent, ok := strings.Cut(name, "."); ok {
+			if cert, ok := set.byName["*."+parent]; ok {
+				return cert, nil
+			}
+		}
+	}
+
+	return set.defaultCert, nil
+}
+
+// watch reloads the certificates when a file changes until done closes.
+func (cs *certStore) watch(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cs.reloadIfChanged()
+		case <-done:
+			return
+		}
+	}
+}
+
+func (cs *certStore) reloadIfChanged() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	modTime, err := cs.newestModTime()
+	if err != nil || !modTime.After(cs.modTime) {
+		return
+	}
+
+	if err := cs.load(); err != nil {
+		log.Printf("Error reloading certificates: %v\n", err)
+		// don't retry the broken files until they change again
+		cs.modTime = modTime
+		return
+	}
+	log.Println("Reloaded TLS certificates")
+}
+
+// setupTLS loads the certificates and returns the config for the
+// listeners.
+func (s *Server) setupTLS() (*tls.Config, error) {
+	cfg := s.tlsConfig
+	if s.eventLoop {
+		return nil, errors.New("TLS cannot be combined with the event loop mode")
+	}
+
+	certs, err := newCertStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.certs = certs
+
+	// every handshake takes the config of the current set, so reloaded
+	// client CAs and CRLs apply right away
+	conf := &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return certs.current.Load().config, nil
+		},
+	}
+
+	if cfg.ReloadInterval > 0 {
+		go certs.watch(cfg.ReloadInterval, s.done)
+	}
+
+	return conf, nil
+}
+
+// connectionState returns the TLS state of conn, nil for plaintext.
+func connectionState(conn net.Conn) *tls.ConnectionState {
+	tc := tlsConn(conn)
+	if tc == nil {
+		return nil
+	}
+
+	state := tc.ConnectionState()
+	return &state
+}
+
+func tlsConn(conn net.Conn) *tls.Conn {
+	if tc, ok := conn.(*trackedConn); ok {
+		conn = tc.Conn
+	}
+
+	tc, _ := conn.(*tls.Conn)
+	return tc
+}
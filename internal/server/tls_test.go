@@ -0,0 +1,158 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self-signed certificate for names to dir and returns
+// the files and the parsed certificate.
+func writeCert(t *testing.T, dir, file string, names ...string) (CertFile, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	files := CertFile{CertFile: filepath.Join(dir, file+".crt"), KeyFile: filepath.Join(dir, file+".key")}
+	require.NoError(t, os.WriteFile(files.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(files.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return files, cert
+}
+
+// handshake connects with SNI name and returns the certificate served.
+func handshake(t *testing.T, addr, name string) *x509.Certificate {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: name, InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	return conn.ConnectionState().PeerCertificates[0]
+}
+
+func TestTLSSNI(t *testing.T) {
+	dir := t.TempDir()
+	defaultFiles, defaultCert := writeCert(t, dir, "default", "example.test")
+	apiFiles, apiCert := writeCert(t, dir, "api", "api.example.test")
+	wildFiles, wildCert := writeCert(t, dir, "wild", "*.apps.example.test")
+
+	var tlsState *tls.ConnectionState
+	_, addr := startServerWith(t, func(w io.Writer, r *request.Request) *HandlerError {
+		tlsState = r.TLS
+		return hello(w, r)
+	}, WithTLS(TLSConfig{Certificates: []CertFile{defaultFiles, apiFiles, wildFiles}}))
+
+	// Test: certificates are picked by exact name, wildcard or default
+	assert.Equal(t, apiCert.Raw, handshake(t, addr, "api.example.test").Raw)
+	assert.Equal(t, wildCert.Raw, handshake(t, addr, "shop.apps.example.test").Raw)
+	assert.Equal(t, defaultCert.Raw, handshake(t, addr, "unknown.test").Raw)
+
+	// Test: handlers see the negotiated TLS state
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: "api.example.test", InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, body := get(t, conn, bufio.NewReader(conn), "/")
+	assert.Equal(t, "hello /", body)
+	require.NotNil(t, tlsState)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsState.Version)
+	assert.Equal(t, "api.example.test", tlsState.ServerName)
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	files, _ := writeCert(t, t.TempDir(), "server", "example.test")
+	_, addr := startServerWith(t, hello, WithTLS(TLSConfig{Certificates: []CertFile{files}, MinVersion: tls.VersionTLS13}))
+
+	// Test: clients below MinVersion fail the handshake
+	_, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12})
+	assert.Error(t, err)
+}
+
+// Test: a client that never finishes the handshake is disconnected
+func TestTLSHandshakeTimeout(t *testing.T) {
+	files, _ := writeCert(t, t.TempDir(), "server", "example.test")
+	srv, addr := startServerWith(t, hello, WithTLS(TLSConfig{Certificates: []CertFile{files}, HandshakeTimeout: 50 * time.Millisecond}))
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	require.Eventually(t, func() bool { return srv.Stats().OpenConns == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestTLSReload(t *testing.T) {
+	dir := t.TempDir()
+	files, first := writeCert(t, dir, "server", "example.test")
+
+	srv, addr := startServerWith(t, hello, WithTLS(TLSConfig{
+		Certificates:   []CertFile{files},
+		ReloadInterval: 10 * time.Millisecond,
+	}))
+	assert.Equal(t, first.Raw, handshake(t, addr, "example.test").Raw)
+
+	// Test: changed files are picked up by polling
+	_, second := writeCert(t, dir, "server", "example.test")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(files.CertFile, future, future))
+	require.Eventually(t, func() bool {
+		return string(handshake(t, addr, "example.test").Raw) == string(second.Raw)
+	}, time.Second, 10*time.Millisecond)
+
+	// Test: ReloadTLS loads the files on demand and keeps the old
+	// certificates when they are broken
+	_, third := writeCert(t, dir, "server", "example.test")
+	require.NoError(t, srv.ReloadTLS())
+	assert.Equal(t, third.Raw, handshake(t, addr, "example.test").Raw)
+
+	require.NoError(t, os.WriteFile(files.KeyFile, []byte("garbage"), 0o600))
+	assert.Error(t, srv.ReloadTLS())
+	assert.Equal(t, third.Raw, handshake(t, addr, "example.test").Raw)
+}
+
+func TestTLSWithEventLoop(t *testing.T) {
+	files, _ := writeCert(t, t.TempDir(), "server", "example.test")
+
+	// Test: the event loop cannot read TLS and is rejected
+	_, err := Serve(0, hello, WithTLS(TLSConfig{Certificates: []CertFile{files}}), WithEventLoop())
+	assert.Error(t, err)
+}
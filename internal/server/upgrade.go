@@ -0,0 +1,190 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment passed from a server to the binary started by Upgrade.
+const (
+	// inheritedListenersEnv lists the listen address of each inherited
+	// descriptor, one per line, starting at descriptor 3.
+	inheritedListenersEnv = "HTTP_SERVER_LISTENERS"
+	// readyFDEnv is the descriptor NotifyReady writes to.
+	readyFDEnv = "HTTP_SERVER_READY_FD"
+)
+
+// Upgrade starts a new copy of the running binary with the same
+// arguments, handing it the listening sockets. Listen in the new process
+// returns the inherited listener for an address instead of opening it, so
+// connections queue up in the shared sockets and none are refused.
+//
+// Upgrade returns once the new process calls NotifyReady. The caller then
+// usually stops this server with Shutdown. If the new process exits or is
+// not ready within readyTimeout it is killed and this server keeps
+// serving.
+func (s *Server) Upgrade(readyTimeout time.Duration) (*os.Process, error) {
+	if s.closed.Load() {
+		return nil, errors.New("server is closed")
+	}
+
+	fds := make([]uintptr, 0, len(s.rawListeners)+1)
+	for _, l := range s.rawListeners {
+		fd, err := listenerFD(l)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s cannot be handed over: %v", l.Addr(), err)
+		}
+		fds = append(fds, fd)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer readyR.Close()
+
+	cmd, err := s.upgradeCommand()
+	if err != nil {
+		readyW.Close()
+		return nil, err
+	}
+	cmd.Env = append(upgradeEnv(cmd.Env),
+		inheritedListenersEnv+"="+strings.Join(s.listenerKeys, "\n"),
+		readyFDEnv+"="+strconv.Itoa(3+len(fds)),
+	)
+
+	proc, err := startProcess(cmd, append(fds, readyW.Fd()))
+	readyW.Close() // the child holds its own copy
+	if err != nil {
+		return nil, fmt.Errorf("failed to start new process: %v", err)
+	}
+
+	go proc.Wait() // reap the child if it exits while we still run
+
+	readyR.SetReadDeadline(time.Now().Add(readyTimeout))
+	if _, err := readyR.Read(make([]byte, 1)); err != nil {
+		proc.Kill()
+		return nil, fmt.Errorf("new process did not become ready: %v", err)
+	}
+
+	// the sockets now belong to the child as well, closing ours must not
+	// remove the unix socket files
+	for _, l := range s.rawListeners {
+		if ul, ok := l.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+
+	return proc, nil
+}
+
+func (s *Server) upgradeCommand() (*exec.Cmd, error) {
+	if s.newUpgradeCmd != nil {
+		return s.newUpgradeCmd(), nil
+	}
+
+	path, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	return exec.Command(path, os.Args[1:]...), nil
+}
+
+// upgradeEnv drops the variables describing our own descriptors, the
+// child's are set from scratch.
+func upgradeEnv(env []string) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+
+	kept := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		switch name {
+		case inheritedListenersEnv, readyFDEnv, "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES":
+			continue
+		}
+		kept = append(kept, kv)
+	}
+	return kept
+}
+
+// NotifyReady tells the server that started this process with Upgrade
+// that it is serving, the old server then stops. Without a parent
+// waiting it does nothing.
+func NotifyReady() error {
+	v := os.Getenv(readyFDEnv)
+	if v == "" {
+		return nil
+	}
+	os.Unsetenv(readyFDEnv)
+
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", readyFDEnv, v)
+	}
+
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// inherited holds the listeners handed over by Upgrade, each taken once
+// by Listen.
+var inherited struct {
+	once      sync.Once
+	mu        sync.Mutex
+	listeners []namedListener
+}
+
+// takeInherited returns the inherited listeners opened for addr.
+func takeInherited(addr string) []net.Listener {
+	inherited.once.Do(func() {
+		inherited.listeners = inheritedListeners(os.Getenv(inheritedListenersEnv), listenFDsStart)
+		os.Unsetenv(inheritedListenersEnv)
+	})
+
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+
+	var taken []net.Listener
+	rest := inherited.listeners[:0]
+	for _, nl := range inherited.listeners {
+		if nl.name == addr {
+			taken = append(taken, nl.listener)
+		} else {
+			rest = append(rest, nl)
+		}
+	}
+	inherited.listeners = rest
+	return taken
+}
+
+// inheritedListeners turns the descriptors from start on into listeners
+// named by their address in env. A descriptor that is no listener is
+// skipped, the address is then opened again.
+func inheritedListeners(env string, start int) []namedListener {
+	if env == "" {
+		return nil
+	}
+
+	var listeners []namedListener
+	for i, addr := range strings.Split(env, "\n") {
+		l, err := fileListener(uintptr(start+i), addr)
+		if err != nil {
+			continue
+		}
+		listeners = append(listeners, namedListener{name: addr, listener: l})
+	}
+	return listeners
+}
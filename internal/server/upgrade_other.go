@@ -0,0 +1,20 @@
+//go:build !unix
+
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+)
+
+var errUpgradeUnsupported = errors.New("binary upgrade is not supported on this platform")
+
+func startProcess(*exec.Cmd, []uintptr) (*os.Process, error) {
+	return nil, errUpgradeUnsupported
+}
+
+func listenerFD(net.Listener) (uintptr, error) {
+	return 0, errUpgradeUnsupported
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const upgradeAddr = "tcp://127.0.0.1:0"
+
+// TestUpgradeChild is the process started by Upgrade in TestUpgrade.
+func TestUpgradeChild(t *testing.T) {
+	if os.Getenv("GO_UPGRADE_CHILD") == "" {
+		t.Skip("helper process for TestUpgrade")
+	}
+
+	child := func(w io.Writer, r *request.Request) *HandlerError {
+		w.Write([]byte("child"))
+		return nil
+	}
+	srv, err := ServeAddrs([]string{upgradeAddr}, child)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	require.NoError(t, NotifyReady())
+	time.Sleep(time.Minute) // until the parent kills us
+}
+
+func TestUpgrade(t *testing.T) {
+	started := make(chan struct{})
+	slow := func(w io.Writer, r *request.Request) *HandlerError {
+		if r.RequestLine.RequestTarget == "/slow" {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte("parent"))
+		return nil
+	}
+
+	srv, err := ServeAddrs([]string{upgradeAddr}, slow)
+	require.NoError(t, err)
+	defer srv.Close()
+	addr := srv.Addrs()[0].String()
+
+	srv.newUpgradeCmd = func() *exec.Cmd {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestUpgradeChild$")
+		cmd.Env = append(os.Environ(), "GO_UPGRADE_CHILD=1")
+		return cmd
+	}
+
+	idle, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer idle.Close()
+	idleReader := bufio.NewReader(idle)
+	_, body := get(t, idle, idleReader, "/")
+	assert.Equal(t, "parent", body)
+
+	inFlight, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer inFlight.Close()
+	_, err = io.WriteString(inFlight, "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	proc, err := srv.Upgrade(10 * time.Second)
+	require.NoError(t, err)
+	defer proc.Kill()
+
+	require.NoError(t, srv.Shutdown(5*time.Second))
+
+	// Test: the request in flight finishes and its connection is closed
+	resp, body := readResponse(t, bufio.NewReader(inFlight))
+	assert.Equal(t, "parent", body)
+	assert.True(t, resp.Close)
+
+	// Test: idle keep-alive connections are closed by Shutdown
+	_, err = idleReader.ReadByte()
+	assert.Error(t, err)
+
+	// Test: new connections on the same address reach the new process
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, body = get(t, conn, bufio.NewReader(conn), "/")
+	assert.Equal(t, "child", body)
+}
+
+// Test: a new process that never becomes ready is killed and the old
+// server keeps serving
+func TestUpgradeNotReady(t *testing.T) {
+	srv, err := ServeAddrs([]string{upgradeAddr}, hello)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	srv.newUpgradeCmd = func() *exec.Cmd {
+		return exec.Command("sleep", "10")
+	}
+
+	_, err = srv.Upgrade(200 * time.Millisecond)
+	require.Error(t, err)
+
+	conn, err := net.Dial("tcp", srv.Addrs()[0].String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, body := get(t, conn, bufio.NewReader(conn), "/")
+	assert.Equal(t, "hello /", body)
+}
@@ -0,0 +1,48 @@
+//go:build unix
+
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startProcess starts cmd sharing our stdio, with extra as descriptors 3
+// and up. The listening sockets are passed as raw descriptors: exec.Cmd
+// would switch them to blocking mode, which also blocks our own Accept.
+func startProcess(cmd *exec.Cmd, extra []uintptr) (*os.Process, error) {
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+
+	pid, err := syscall.ForkExec(cmd.Path, cmd.Args, &syscall.ProcAttr{
+		Dir:   cmd.Dir,
+		Env:   cmd.Env,
+		Files: append([]uintptr{0, 1, 2}, extra...),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return os.FindProcess(pid)
+}
+
+func listenerFD(l net.Listener) (uintptr, error) {
+	sc, ok := l.(syscall.Conn)
+	if !ok {
+		return 0, errors.New("no file descriptor")
+	}
+
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var fd uintptr
+	if err := rc.Control(func(f uintptr) { fd = f }); err != nil {
+		return 0, err
+	}
+	return fd, nil
+}
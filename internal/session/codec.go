@@ -0,0 +1,141 @@
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoKeys         = errors.New("session: at least one key is required")
+	ErrShortKey       = errors.New("session: keys must be at least 32 bytes")
+	ErrInvalidCookie  = errors.New("session: invalid cookie value")
+	ErrExpiredCookie  = errors.New("session: cookie timestamp expired")
+	ErrCookieTooLarge = errors.New("session: encoded cookie exceeds 4096 bytes")
+)
+
+const maxCookieSize = 4096
+
+type codecKey struct {
+	mac  []byte
+	aead cipher.AEAD
+}
+
+// codec signs with HMAC-SHA256 and encrypts with AES-256-GCM. The first
+// key encodes, every key is tried when decoding so old keys can be kept
+// around during rotation.
+type codec struct {
+	keys []codecKey
+}
+
+func newCodec(secrets [][]byte) (*codec, error) {
+	if len(secrets) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	c := &codec{}
+	for _, secret := range secrets {
+		if len(secret) < 32 {
+			return nil, ErrShortKey
+		}
+
+		block, err := aes.NewCipher(deriveKey(secret, "encrypt"))
+		if err != nil {
+			return nil, err
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		c.keys = append(c.keys, codecKey{mac: deriveKey(secret, "sign"), aead: aead})
+	}
+
+	return c, nil
+}
+
+func deriveKey(secret []byte, label string) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte("http-server session " + label))
+	return m.Sum(nil)
+}
+
+// encode returns base64url(timestamp | nonce | ciphertext | mac). The
+// cookie name is bound into both the GCM additional data and the MAC so a
+// value can't be replayed under another cookie name.
+func (c *codec) encode(name string, payload []byte, now time.Time) (string, error) {
+	key := c.keys[0]
+
+	body := make([]byte, 8, 8+key.aead.NonceSize()+len(payload)+key.aead.Overhead())
+	binary.BigEndian.PutUint64(body, uint64(now.Unix()))
+
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	body = append(body, nonce...)
+	body = key.aead.Seal(body, nonce, payload, []byte(name))
+	body = append(body, sign(key.mac, name, body)...)
+
+	value := base64.RawURLEncoding.EncodeToString(body)
+	if len(name)+len(value) > maxCookieSize {
+		return "", ErrCookieTooLarge
+	}
+
+	return value, nil
+}
+
+// decode verifies and decrypts a value produced by encode. Values older
+// than maxAge are rejected when maxAge > 0.
+func (c *codec) decode(name, value string, maxAge time.Duration, now time.Time) ([]byte, error) {
+	if len(value) > maxCookieSize {
+		return nil, ErrInvalidCookie
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+
+	for _, key := range c.keys {
+		if len(raw) < 8+key.aead.NonceSize()+sha256.Size {
+			continue
+		}
+
+		body, mac := raw[:len(raw)-sha256.Size], raw[len(raw)-sha256.Size:]
+		if !hmac.Equal(mac, sign(key.mac, name, body)) {
+			continue
+		}
+
+		ts := time.Unix(int64(binary.BigEndian.Uint64(body[:8])), 0)
+		if maxAge > 0 && now.Sub(ts) > maxAge {
+			return nil, ErrExpiredCookie
+		}
+
+		nonce := body[8 : 8+key.aead.NonceSize()]
+		payload, err := key.aead.Open(nil, nonce, body[8+key.aead.NonceSize():], []byte(name))
+		if err != nil {
+			return nil, ErrInvalidCookie
+		}
+
+		return payload, nil
+	}
+
+	return nil, ErrInvalidCookie
+}
+
+func sign(key []byte, name string, body []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(name))
+	m.Write([]byte{'|'})
+	m.Write(body)
+	return m.Sum(nil)
+}
@@ -0,0 +1,246 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/harry713j/http-server/internal/server"
+)
+
+type Options struct {
+	CookieName string
+	Path       string
+	Domain     string
+	Secure     bool
+	SameSite   header.SameSite
+
+	// Keys sign and encrypt the cookie. Keys[0] is used for new cookies,
+	// the rest are only accepted when decoding, so rotating means
+	// prepending a new key and dropping the oldest one later.
+	Keys [][]byte
+
+	// IdleTimeout expires sessions that haven't been used for that long,
+	// AbsoluteTimeout expires sessions that long after they were created.
+	// Zero disables the respective limit.
+	IdleTimeout     time.Duration
+	AbsoluteTimeout time.Duration
+
+	// Store keeps sessions server side. When nil the whole session is
+	// stored client side in the encrypted cookie.
+	Store Store
+}
+
+type Manager struct {
+	opts  Options
+	codec *codec
+	now   func() time.Time
+}
+
+func NewManager(opts Options) (*Manager, error) {
+	c, err := newCodec(opts.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.CookieName == "" {
+		opts.CookieName = "session"
+	}
+
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+
+	if opts.SameSite == header.SameSiteDefault {
+		opts.SameSite = header.SameSiteLax
+	}
+
+	return &Manager{opts: opts, codec: c, now: time.Now}, nil
+}
+
+// contextKey holds the session on the request context, one key per
+// Manager.
+type contextKey struct{ m *Manager }
+
+// Get returns the session of a request handled by the Middleware, or nil.
+func (m *Manager) Get(r *request.Request) *Session {
+	s, _ := r.Context().Value(contextKey{m}).(*Session)
+	return s
+}
+
+// Middleware loads the session before calling next and saves it, along
+// with the Set-Cookie header, right before the response headers are
+// written.
+func (m *Manager) Middleware(next server.Handler) server.Handler {
+	return func(w io.Writer, r *request.Request) *server.HandlerError {
+		s := m.load(r)
+		r.SetContext(context.WithValue(r.Context(), contextKey{m}, s))
+
+		respWriter := response.NewWriter(w)
+		respWriter.BeforeWriteHeaders(func(h header.Headers) {
+			if err := m.commit(respWriter, s); err != nil {
+				log.Printf("Error saving session: %v\n", err)
+			}
+		})
+
+		return next(respWriter, r)
+	}
+}
+
+func (m *Manager) load(r *request.Request) *Session {
+	now := m.now()
+
+	c, err := r.Cookie(m.opts.CookieName)
+	if err != nil {
+		return newSession(now)
+	}
+
+	payload, err := m.codec.decode(m.opts.CookieName, c.Value, m.opts.AbsoluteTimeout, now)
+	if err != nil {
+		return newSession(now)
+	}
+
+	var s *Session
+	if m.opts.Store != nil {
+		s, err = m.opts.Store.Load(string(payload))
+		if err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				log.Printf("Error loading session: %v\n", err)
+			}
+			return newSession(now)
+		}
+	} else {
+		s = &Session{}
+		if err := json.Unmarshal(payload, s); err != nil || s.Values == nil {
+			return newSession(now)
+		}
+	}
+
+	if m.expired(s, now) {
+		if m.opts.Store != nil {
+			m.opts.Store.Delete(s.ID)
+		}
+		return newSession(now)
+	}
+
+	// sliding idle expiry needs LastSeen refreshed on every request
+	s.isNew = false
+	s.modified = m.opts.IdleTimeout > 0
+	s.LastSeen = now
+
+	return s
+}
+
+func (m *Manager) expired(s *Session, now time.Time) bool {
+	if m.opts.IdleTimeout > 0 && now.Sub(s.LastSeen) > m.opts.IdleTimeout {
+		return true
+	}
+
+	if m.opts.AbsoluteTimeout > 0 && now.Sub(s.CreatedAt) > m.opts.AbsoluteTimeout {
+		return true
+	}
+
+	return false
+}
+
+func (m *Manager) commit(w *response.Writer, s *Session) error {
+	if m.opts.Store != nil {
+		for _, id := range s.oldIDs {
+			if err := m.opts.Store.Delete(id); err != nil {
+				return err
+			}
+		}
+		s.oldIDs = nil
+	}
+
+	if s.destroyed {
+		if m.opts.Store != nil {
+			if err := m.opts.Store.Delete(s.ID); err != nil {
+				return err
+			}
+		}
+
+		// a brand new session that was destroyed never reached the client
+		if s.isNew {
+			return nil
+		}
+		return w.SetCookie(m.cookie("", -1))
+	}
+
+	if !s.modified {
+		return nil
+	}
+
+	// don't hand out cookies for sessions nobody wrote to
+	if s.isNew && len(s.Values) == 0 {
+		return nil
+	}
+
+	now := m.now()
+	s.ExpiresAt = m.expiresAt(s)
+
+	var payload []byte
+	if m.opts.Store != nil {
+		if err := m.opts.Store.Save(s); err != nil {
+			return err
+		}
+		payload = []byte(s.ID)
+	} else {
+		var err error
+		if payload, err = json.Marshal(s); err != nil {
+			return err
+		}
+	}
+
+	value, err := m.codec.encode(m.opts.CookieName, payload, now)
+	if err != nil {
+		return err
+	}
+
+	maxAge := 0
+	if !s.ExpiresAt.IsZero() {
+		maxAge = int(s.ExpiresAt.Sub(now).Seconds())
+		if maxAge <= 0 {
+			maxAge = -1
+		}
+	}
+
+	s.modified = false
+	return w.SetCookie(m.cookie(value, maxAge))
+}
+
+func (m *Manager) expiresAt(s *Session) time.Time {
+	var expires time.Time
+
+	if m.opts.IdleTimeout > 0 {
+		expires = s.LastSeen.Add(m.opts.IdleTimeout)
+	}
+
+	if m.opts.AbsoluteTimeout > 0 {
+		absolute := s.CreatedAt.Add(m.opts.AbsoluteTimeout)
+		if expires.IsZero() || absolute.Before(expires) {
+			expires = absolute
+		}
+	}
+
+	return expires
+}
+
+func (m *Manager) cookie(value string, maxAge int) *header.Cookie {
+	return &header.Cookie{
+		Name:     m.opts.CookieName,
+		Value:    value,
+		Path:     m.opts.Path,
+		Domain:   m.opts.Domain,
+		MaxAge:   maxAge,
+		Secure:   m.opts.Secure,
+		HttpOnly: true,
+		SameSite: m.opts.SameSite,
+	}
+}
@@ -0,0 +1,87 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Session holds the per-client values kept between requests.
+type Session struct {
+	ID        string            `json:"id"`
+	Values    map[string]string `json:"values"`
+	CreatedAt time.Time         `json:"created_at"`
+	LastSeen  time.Time         `json:"last_seen"`
+	// ExpiresAt is set by the Manager so stores can drop stale sessions
+	ExpiresAt time.Time `json:"expires_at"`
+
+	isNew     bool
+	modified  bool
+	destroyed bool
+	oldIDs    []string
+}
+
+func newSession(now time.Time) *Session {
+	return &Session{
+		ID:        newID(),
+		Values:    map[string]string{},
+		CreatedAt: now,
+		LastSeen:  now,
+		isNew:     true,
+		modified:  true,
+	}
+}
+
+func (s *Session) Get(key string) string {
+	return s.Values[key]
+}
+
+func (s *Session) Set(key, value string) {
+	s.Values[key] = value
+	s.modified = true
+}
+
+func (s *Session) Delete(key string) {
+	if _, ok := s.Values[key]; ok {
+		delete(s.Values, key)
+		s.modified = true
+	}
+}
+
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+// Regenerate gives the session a fresh ID while keeping its values. Call
+// it whenever the privilege level changes (login, logout, sudo) to
+// prevent session fixation.
+func (s *Session) Regenerate() {
+	s.oldIDs = append(s.oldIDs, s.ID)
+	s.ID = newID()
+	s.CreatedAt = time.Now()
+	s.modified = true
+}
+
+// Destroy drops all values and expires the session cookie.
+func (s *Session) Destroy() {
+	s.Values = map[string]string{}
+	s.destroyed = true
+	s.modified = true
+}
+
+func newID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("session: failed to read random bytes: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+func isValidID(id string) bool {
+	if len(id) != 64 {
+		return false
+	}
+
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
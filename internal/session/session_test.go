@@ -0,0 +1,161 @@
+package session
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/harry713j/http-server/internal/header"
+	"github.com/harry713j/http-server/internal/request"
+	"github.com/harry713j/http-server/internal/response"
+	"github.com/harry713j/http-server/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	oldKey = bytes.Repeat([]byte("o"), 32)
+	newKey = bytes.Repeat([]byte("n"), 32)
+)
+
+// Test: Codec round trip, tampering and key rotation
+func TestCodec(t *testing.T) {
+	now := time.Now()
+	old, err := newCodec([][]byte{oldKey})
+	require.NoError(t, err)
+
+	value, err := old.encode("session", []byte("payload"), now)
+	require.NoError(t, err)
+
+	payload, err := old.decode("session", value, 0, now)
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(payload))
+
+	// bound to the cookie name
+	_, err = old.decode("other", value, 0, now)
+	assert.ErrorIs(t, err, ErrInvalidCookie)
+
+	// tampered
+	tampered := []byte(value)
+	tampered[10] ^= 1
+	_, err = old.decode("session", string(tampered), 0, now)
+	assert.Error(t, err)
+
+	// expired
+	_, err = old.decode("session", value, time.Minute, now.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrExpiredCookie)
+
+	// rotated: new key first, old key still accepted
+	rotated, err := newCodec([][]byte{newKey, oldKey})
+	require.NoError(t, err)
+	payload, err = rotated.decode("session", value, 0, now)
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(payload))
+
+	// old key dropped
+	dropped, err := newCodec([][]byte{newKey})
+	require.NoError(t, err)
+	_, err = dropped.decode("session", value, 0, now)
+	assert.ErrorIs(t, err, ErrInvalidCookie)
+
+	_, err = newCodec([][]byte{[]byte("short")})
+	assert.ErrorIs(t, err, ErrShortKey)
+}
+
+var setCookieRe = regexp.MustCompile(`Set-Cookie: session=([^;]*);`)
+
+// serve runs a request with the given cookie through the middleware and
+// returns the new session cookie value, if any.
+func serve(t *testing.T, m *Manager, cookie string, h server.Handler) string {
+	t.Helper()
+
+	req := &request.Request{Headers: header.NewHeaders()}
+	if cookie != "" {
+		req.Headers.Add("cookie", "session="+cookie)
+	}
+
+	var out bytes.Buffer
+	w := response.NewWriter(&out)
+	hErr := m.Middleware(h)(w, req)
+	require.Nil(t, hErr)
+
+	if !w.Started() {
+		require.NoError(t, w.WriteStatusLine(response.StatusOk))
+		require.NoError(t, w.WriteHeaders(response.GetDefaultHeaders(0)))
+	}
+
+	match := setCookieRe.FindStringSubmatch(out.String())
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+func testManager(t *testing.T, store Store) {
+	m, err := NewManager(Options{Keys: [][]byte{newKey}, IdleTimeout: time.Hour, Store: store})
+	require.NoError(t, err)
+
+	// untouched sessions don't set a cookie
+	cookie := serve(t, m, "", func(w io.Writer, r *request.Request) *server.HandlerError {
+		return nil
+	})
+	assert.Empty(t, cookie)
+
+	cookie = serve(t, m, "", func(w io.Writer, r *request.Request) *server.HandlerError {
+		m.Get(r).Set("user", "alice")
+		return nil
+	})
+	require.NotEmpty(t, cookie)
+
+	var firstID string
+	cookie = serve(t, m, cookie, func(w io.Writer, r *request.Request) *server.HandlerError {
+		s := m.Get(r)
+		assert.False(t, s.IsNew())
+		assert.Equal(t, "alice", s.Get("user"))
+		firstID = s.ID
+		s.Regenerate()
+		return nil
+	})
+	require.NotEmpty(t, cookie)
+
+	serve(t, m, cookie, func(w io.Writer, r *request.Request) *server.HandlerError {
+		s := m.Get(r)
+		assert.Equal(t, "alice", s.Get("user"))
+		assert.NotEqual(t, firstID, s.ID)
+		return nil
+	})
+
+	if store != nil {
+		_, err := store.Load(firstID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+
+	// idle expiry
+	m.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	serve(t, m, cookie, func(w io.Writer, r *request.Request) *server.HandlerError {
+		assert.True(t, m.Get(r).IsNew())
+		return nil
+	})
+}
+
+// Test: Client side cookie sessions
+func TestManagerCookieStore(t *testing.T) {
+	testManager(t, nil)
+}
+
+// Test: Server side memory sessions
+func TestManagerMemoryStore(t *testing.T) {
+	testManager(t, NewMemoryStore())
+}
+
+// Test: Server side file sessions
+func TestManagerFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	testManager(t, store)
+
+	_, err = store.Load("../../etc/passwd")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,219 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("session: not found")
+
+// Store keeps sessions on the server side; only the session ID travels in
+// the cookie. Load must return ErrNotFound for unknown or expired IDs.
+type Store interface {
+	Load(id string) (*Session, error)
+	Save(s *Session) error
+	Delete(id string) error
+}
+
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: map[string]Session{}}
+}
+
+func (m *MemoryStore) Load(id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if expired(&s, time.Now()) {
+		delete(m.sessions, id)
+		return nil, ErrNotFound
+	}
+
+	return copySession(&s), nil
+}
+
+func (m *MemoryStore) Save(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[s.ID] = *copySession(s)
+	return nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+// Cleanup removes expired sessions; run it periodically.
+func (m *MemoryStore) Cleanup() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, s := range m.sessions {
+		if expired(&s, now) {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+// FileStore keeps one JSON file per session in dir.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create session dir: %v", err)
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+func (f *FileStore) path(id string) (string, error) {
+	// IDs come from cookies, never let them escape the directory
+	if !isValidID(id) {
+		return "", ErrNotFound
+	}
+
+	return filepath.Join(f.dir, id+".json"), nil
+}
+
+func (f *FileStore) Load(id string) (*Session, error) {
+	path, err := f.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+
+	if expired(&s, time.Now()) {
+		os.Remove(path)
+		return nil, ErrNotFound
+	}
+
+	if s.Values == nil {
+		s.Values = map[string]string{}
+	}
+
+	return &s, nil
+}
+
+func (f *FileStore) Save(s *Session) error {
+	path, err := f.path(s.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// write to a temp file and rename so readers never see a partial file
+	tmp, err := os.CreateTemp(f.dir, ".session-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *FileStore) Delete(id string) error {
+	path, err := f.path(id)
+	if err != nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Cleanup removes expired session files; run it periodically.
+func (f *FileStore) Cleanup() error {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || !isValidID(id) {
+			continue
+		}
+
+		// Load removes the file when the session has expired
+		if _, err := f.Load(id); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func expired(s *Session, now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && now.After(s.ExpiresAt)
+}
+
+func copySession(s *Session) *Session {
+	c := *s
+	c.Values = make(map[string]string, len(s.Values))
+	for k, v := range s.Values {
+		c.Values[k] = v
+	}
+	c.oldIDs = nil
+	return &c
+}